@@ -0,0 +1,106 @@
+package symboltab
+
+// batchSize is the number of strings we hash before probing the table. Looking
+// at the table slots for a whole batch before doing the full probes lets the
+// CPU fetch many slots from memory at once.
+const batchSize = 32
+
+// StringsToSequences looks up each string in vals and writes its sequence
+// number to the corresponding position in out, which must be at least as long
+// as vals. If addNew is true strings that are not present are added, otherwise
+// their sequence number is 0. It returns the number of strings that were added.
+//
+// If addNew is true, all the strings are looked up first and then the ones
+// that were missing are added. If they won't fit, the table grows once to a
+// size that holds them all, rather than doubling repeatedly as they are added.
+// It still grows incrementally, just as it does for StringToSequence.
+func (i *Tab[S]) StringsToSequences(vals []string, out []S, addNew bool) (added int) {
+	out = out[:len(vals)]
+	if addNew && i.seed == 0 {
+		i.initSeed()
+	}
+	misses := i.lookupBatch(vals, out)
+	if !addNew || misses == 0 {
+		return 0
+	}
+
+	i.reserve(misses)
+	for j, val := range vals {
+		if out[j] != 0 {
+			continue
+		}
+		seq, found, _ := i.stringToSequence(val, i.hash.sum32(val, i.seed), true)
+		out[j] = seq
+		if !found && seq != 0 {
+			added++
+		}
+	}
+	return added
+}
+
+// lookupBatch looks up each string in vals without adding it and writes its
+// sequence number to out. It returns the number of strings not found.
+func (i *Tab[S]) lookupBatch(vals []string, out []S) (misses int) {
+	var hashes [batchSize]uint32
+	var sink S
+	for len(vals) > 0 {
+		n := min(len(vals), batchSize)
+		for j, val := range vals[:n] {
+			hashes[j] = i.hash.sum32(val, i.seed)
+		}
+		if ctrl := i.table.ctrl; ctrl != nil {
+			for _, hash := range hashes[:n] {
+				sink += S(ctrl[int(hash)&(len(ctrl)-1)])
+			}
+		} else if l := i.table.len(); l != 0 {
+			for _, hash := range hashes[:n] {
+				sink += i.table.entries[int(hash)&(l-1)].sequence
+			}
+		}
+		for j, val := range vals[:n] {
+			out[j], _, _ = i.stringToSequence(val, hashes[j], false)
+			if out[j] == 0 {
+				misses++
+			}
+		}
+		vals, out = vals[n:], out[n:]
+	}
+	_ = sink
+
+	return misses
+}
+
+// SequencesToStrings looks up the string for each sequence number in seqs and
+// writes it to the corresponding position in out, which must be at least as
+// long as seqs.
+func (i *Tab[S]) SequencesToStrings(seqs []S, out []string) {
+	out = out[:len(seqs)]
+	for j, seq := range seqs {
+		out[j] = i.SequenceToString(seq)
+	}
+}
+
+// reserve prepares the table for n more strings. If they won't fit, it
+// arranges for the next resize to grow the table straight to a size that will
+// hold them, and starts allocating that table in the background. The resize
+// itself happens incrementally when the table fills, as usual.
+func (i *Tab[S]) reserve(n int) {
+	if err := i.resize(); err != nil {
+		return
+	}
+	if i.tuning.tableLen(i.count+i.tombstones+n) <= i.table.len() {
+		return
+	}
+	// Tombstones are not copied when the table grows
+	needed := min(i.tuning.tableLen(i.count+n), maxTableLen)
+	if needed <= i.nextTableLen() {
+		// The normal growth step is big enough
+		return
+	}
+	i.reserveLen = needed
+	if i.oldTable.len() == 0 {
+		// Replace any table prepareNext has already started on with one of
+		// the new size
+		i.prepareNext()
+	}
+}
@@ -0,0 +1,121 @@
+package symboltab
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringsToSequences(t *testing.T) {
+	st := New(16)
+
+	vals := make([]string, 10_000)
+	for i := range vals {
+		vals[i] = strconv.Itoa(i)
+	}
+	seqs := make([]uint32, len(vals))
+
+	added := st.StringsToSequences(vals[:100], seqs, false)
+	assert.Zero(t, added)
+	for _, seq := range seqs[:100] {
+		assert.Zero(t, seq)
+	}
+
+	// Add some in a batch that requires the table to grow
+	added = st.StringsToSequences(vals[:5_000], seqs, true)
+	assert.Equal(t, 5_000, added)
+	for i, seq := range seqs[:5_000] {
+		assert.Equal(t, uint32(i+1), seq)
+	}
+
+	// Add some more while a resize is in progress
+	for i := 5_000; i < 8_500; i++ {
+		st.StringToSequence(vals[i], true)
+	}
+	assert.NotZero(t, st.oldTable.len())
+
+	added = st.StringsToSequences(vals, seqs, true)
+	assert.Equal(t, 1_500, added)
+	for i, seq := range seqs {
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	assert.Equal(t, 10_000, st.Len())
+
+	strs := make([]string, len(seqs))
+	st.SequencesToStrings(seqs, strs)
+	assert.Equal(t, vals, strs)
+
+	// Duplicates within a batch are only added once
+	added = st.StringsToSequences([]string{"a", "b", "a"}, seqs, true)
+	assert.Equal(t, 2, added)
+	assert.Equal(t, []uint32{10_001, 10_002, 10_001}, seqs[:3])
+}
+
+func TestStringsToSequencesGrowth(t *testing.T) {
+	st := New(16)
+
+	vals := make([]string, 10_000)
+	for i := range vals {
+		vals[i] = strconv.Itoa(i)
+	}
+	seqs := make([]uint32, len(vals))
+
+	// A batch that needs the table to grow several times over grows it once,
+	// incrementally
+	added := st.StringsToSequences(vals[:5_000], seqs, true)
+	assert.Equal(t, 5_000, added)
+	assert.Equal(t, 1, st.resizes)
+	assert.Equal(t, 16_384, st.table.len())
+
+	// A batch of strings that are already present doesn't grow the table,
+	// and only the new strings count towards growing it
+	l := st.table.len()
+	added = st.StringsToSequences(vals[:5_000], seqs, true)
+	assert.Zero(t, added)
+	assert.Equal(t, l, st.table.len())
+	assert.Equal(t, 1, st.resizes)
+
+	added = st.StringsToSequences(vals[:6_000], seqs, true)
+	assert.Equal(t, 1_000, added)
+	assert.Equal(t, l, st.table.len())
+	assert.Equal(t, 1, st.resizes)
+	for i, seq := range seqs[:6_000] {
+		assert.Equal(t, uint32(i+1), seq)
+	}
+}
+
+func TestStringsToSequencesZeroValue(t *testing.T) {
+	var st SymbolTab
+	seqs := make([]uint32, 2)
+	assert.Zero(t, st.StringsToSequences([]string{"a", "b"}, seqs, false))
+	assert.Equal(t, 2, st.StringsToSequences([]string{"a", "b"}, seqs, true))
+	assert.Equal(t, []uint32{1, 2}, seqs)
+}
+
+func BenchmarkStringsToSequences(b *testing.B) {
+	symbols := make([]string, b.N)
+	for i := range symbols {
+		symbols[i] = strconv.Itoa(i)
+	}
+	seqs := make([]uint32, b.N)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	st := New(b.N)
+	st.StringsToSequences(symbols, seqs, true)
+}
+
+func BenchmarkStringsToSequencesExisting(b *testing.B) {
+	st := New(b.N)
+	values := make([]string, b.N)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	seqs := make([]uint32, b.N)
+	st.StringsToSequences(values, seqs, true)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	st.StringsToSequences(values, seqs, false)
+}
@@ -1,8 +1,17 @@
 module github.com/philpearl/symboltab/bench
 
-go 1.12
+go 1.24
 
 require (
 	github.com/loov/hrtime v1.0.1
 	github.com/philpearl/symboltab v1.1.1
 )
+
+require (
+	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
+	github.com/philpearl/stringbank v1.1.0 // indirect
+	github.com/zeebo/xxh3 v1.1.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
+
+replace github.com/philpearl/symboltab => ../
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/loov/hrtime"
@@ -13,13 +16,37 @@ import (
 const count = 1e7
 
 func main() {
-	b := hrtime.NewBenchmarkTSC(count)
+	mode := flag.String("mode", "latency", "benchmark to run: latency or scaling")
+	flag.Parse()
 
 	symbols := make([]string, count)
 	for i := range symbols {
 		symbols[i] = strconv.Itoa(i)
 	}
 
+	switch *mode {
+	case "latency":
+		latency(symbols)
+	case "scaling":
+		scaling(symbols)
+	default:
+		fmt.Printf("unknown mode %q\n", *mode)
+	}
+}
+
+func latency(symbols []string) {
+	b := hrtime.NewBenchmarkTSC(count)
+
+	// In a long running process big allocations reuse memory the GC has freed,
+	// and that memory has to be zeroed. A fresh process gets memory from the OS
+	// that is already zero. To see what happens in a long running process we
+	// fill a table and throw it away first.
+	warm := symboltab.New(0)
+	for _, val := range symbols {
+		warm.StringToSequence(val, true)
+	}
+	warm = nil
+
 	st := symboltab.New(0)
 
 	runtime.GC()
@@ -28,13 +55,15 @@ func main() {
 		if i >= count {
 			i = 0
 		}
+		cap := st.Cap()
 		t := hrtime.TSC()
 		st.StringToSequence(symbols[i], true)
 		st.StringToSequence(symbols[i], true)
 		dur := hrtime.TSC() - t
+		if st.Cap() != cap {
+			fmt.Printf("grew to %d at %d in %s\n", st.Cap(), i, dur.ApproxDuration())
+		}
 		if dur.ApproxDuration() > time.Millisecond*100 {
-			// When we grow the table to larger sizes we see slow performance. It seems that just allocating
-			// these very big slices takes > 100ms, presumably because they are zeroed
 			fmt.Printf("big number at %d\n", i)
 		}
 	}
@@ -47,3 +76,48 @@ func main() {
 	}
 	fmt.Println(hrtime.NewDurationHistogram(b.Laps(), &opts))
 }
+
+// scaling shows how ingestion scales with the number of goroutines adding
+// strings, comparing a ShardedSymbolTab with a SymbolTab behind a mutex.
+func scaling(symbols []string) {
+	for procs := 1; procs <= runtime.NumCPU(); procs *= 2 {
+		runtime.GOMAXPROCS(procs)
+
+		sharded := symboltab.NewSharded(procs*8, 0)
+		shardedDur := ingest(procs, symbols, func(val string) {
+			sharded.StringToSequence(val, true)
+		})
+
+		var mu sync.Mutex
+		st := symboltab.New(0)
+		mutexDur := ingest(procs, symbols, func(val string) {
+			mu.Lock()
+			st.StringToSequence(val, true)
+			mu.Unlock()
+		})
+
+		fmt.Printf("%3d goroutines: sharded %6.1f ns/op, mutex %6.1f ns/op\n",
+			procs,
+			float64(shardedDur)/float64(len(symbols)),
+			float64(mutexDur)/float64(len(symbols)),
+		)
+	}
+}
+
+func ingest(procs int, symbols []string, add func(val string)) time.Duration {
+	runtime.GC()
+	start := time.Now()
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := next.Add(1) - 1; i < int64(len(symbols)); i = next.Add(1) - 1 {
+				add(symbols[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
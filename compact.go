@@ -0,0 +1,67 @@
+package symboltab
+
+import (
+	"unsafe"
+
+	"github.com/philpearl/stringbank"
+)
+
+// CompactReport describes the space reclaimed by Compact
+type CompactReport struct {
+	// Strings is the number of live strings that were copied
+	Strings int
+	// StringBytesBefore and StringBytesAfter are the size of the string
+	// storage, as reported by SymbolSize, before and after compaction
+	StringBytesBefore int
+	StringBytesAfter  int
+	// IntbankBytes is the space released from the sequence number to string
+	// mapping
+	IntbankBytes int
+}
+
+// Reclaimed returns the total number of bytes reclaimed
+func (r CompactReport) Reclaimed() int {
+	return r.StringBytesBefore - r.StringBytesAfter + r.IntbankBytes
+}
+
+// Compact reclaims the space used by deleted strings. Live strings are copied
+// into fresh storage, so Compact takes time proportional to the number of live
+// strings and the size of the table, but not to the number of strings that
+// have been deleted. Sequence numbers of live strings do not change.
+//
+// Storage for ranges of sequence numbers that have all been deleted is also
+// released. Those sequence numbers are never reused, even if RecycleSequences
+// is on. Other deleted sequence numbers are reused lowest first after
+// compaction.
+func (i *Tab[S]) Compact() CompactReport {
+	r := CompactReport{
+		StringBytesBefore: i.sb.Size(),
+	}
+
+	// Each live string has one live entry in the table, or in the part of
+	// the old table that hasn't been copied yet if we're resizing
+	var sb stringbank.Stringbank
+	copyString := func(e tableEntry[S]) {
+		if e.live() {
+			i.ib.save(e.sequence, sb.Save(i.sb.Get(i.ib.lookup(e.sequence))))
+			r.Strings++
+		}
+	}
+	for _, e := range i.table.entries {
+		copyString(e)
+	}
+	if i.oldTable.len() != 0 {
+		for _, e := range i.oldTable.entries[i.oldTableCursor:] {
+			copyString(e)
+		}
+	}
+	i.sb = sb
+	i.deadBytes = 0
+	r.StringBytesAfter = i.sb.Size()
+
+	var released int
+	i.freeList, released = i.ib.releaseDeleted(i.maxSequence)
+	r.IntbankBytes = released * intbanksize * int(unsafe.Sizeof(int(0)))
+
+	return r
+}
@@ -0,0 +1,74 @@
+package symboltab
+
+import "unsafe"
+
+// Delete removes val from the SymbolTab. It returns false if val was not present.
+//
+// The sequence number for val is not reused unless RecycleSequences has been turned
+// on. The space used by the string is reclaimed by Compact. Delete calls Compact
+// itself once deleted strings take up half the string storage, so the storage
+// stays in proportion to the live strings. Without RecycleSequences the space
+// for deleted sequence numbers counts towards this too. Compacting resets the
+// order in which sequence numbers are reused, as described for Compact.
+func (i *Tab[S]) Delete(val string) bool {
+	hash := i.hash.sum32(val, i.seed)
+
+	// During a resize the entry may be in the old table, the new table or both. We
+	// need to remove it from wherever it is.
+	var seq S
+	if i.oldTable.len() != 0 {
+		if cursor, sequence := i.findInTable(i.oldTable, val, hash); sequence != 0 {
+			i.oldTable.remove(cursor)
+			seq = sequence
+		}
+	}
+	if cursor, sequence := i.findInTable(i.table, val, hash); sequence != 0 {
+		if i.table.remove(cursor) {
+			i.tombstones++
+		}
+		seq = sequence
+	}
+	if seq == 0 {
+		return false
+	}
+
+	i.ib.delete(seq, i.freeList)
+	i.freeList = seq
+	i.count--
+	i.indexDelete(seq)
+
+	i.deadBytes += len(val)
+	if !i.recycle {
+		// The sequence number's space in the intbank is only released by
+		// Compact
+		i.deadBytes += int(unsafe.Sizeof(int(0)))
+	}
+	if i.deadBytes >= compactMinBytes && i.deadBytes >= i.sb.Size()/2 {
+		i.Compact()
+	}
+	return true
+}
+
+// compactMinBytes is the least space deleted strings must take before Delete
+// compacts the string storage. It's the size of the chunks the stringbank
+// allocates, so small tables aren't compacted over and over. It's a variable
+// so tests can change it.
+var compactMinBytes = 1 << 18
+
+// DeleteSequence removes the string with sequence number seq from the SymbolTab. It
+// returns false if seq is not present.
+func (i *Tab[S]) DeleteSequence(seq S) bool {
+	val, ok := i.LookupSequence(seq)
+	if !ok {
+		return false
+	}
+	return i.Delete(val)
+}
+
+// RecycleSequences controls whether sequence numbers freed by Delete and
+// DeleteSequence are reused for new strings. It is off by default, so sequence
+// numbers are never reused. If it is on, the most recently freed sequence number
+// is used first.
+func (i *Tab[S]) RecycleSequences(recycle bool) {
+	i.recycle = recycle
+}
@@ -0,0 +1,206 @@
+package symboltab
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelete(t *testing.T) {
+	st := New(16)
+	for _, val := range []string{"a", "b", "c"} {
+		st.StringToSequence(val, true)
+	}
+
+	assert.True(t, st.Delete("b"))
+	assert.False(t, st.Delete("b"))
+	assert.False(t, st.Delete("d"))
+	assert.Equal(t, 2, st.Len())
+
+	_, found := st.StringToSequence("b", false)
+	assert.False(t, found)
+	_, ok := st.LookupSequence(2)
+	assert.False(t, ok)
+
+	seq, found := st.StringToSequence("c", false)
+	assert.True(t, found)
+	assert.Equal(t, uint32(3), seq)
+
+	assert.True(t, st.DeleteSequence(1))
+	assert.False(t, st.DeleteSequence(1))
+	assert.False(t, st.DeleteSequence(0))
+	assert.False(t, st.DeleteSequence(37))
+	assert.Equal(t, 1, st.Len())
+
+	// Sequence numbers are not reused by default
+	seq, found = st.StringToSequence("b", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(4), seq)
+
+	var seqs []uint32
+	for seq := range st.All() {
+		seqs = append(seqs, seq)
+	}
+	assert.Equal(t, []uint32{3, 4}, seqs)
+}
+
+func TestDeleteRecycle(t *testing.T) {
+	st := New(16)
+	st.RecycleSequences(true)
+	for _, val := range []string{"a", "b", "c", "d"} {
+		st.StringToSequence(val, true)
+	}
+	assert.True(t, st.Delete("b"))
+	assert.True(t, st.Delete("c"))
+
+	// Most recently freed sequence numbers are used first
+	seq, found := st.StringToSequence("e", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(3), seq)
+	seq, found = st.StringToSequence("f", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(2), seq)
+	seq, found = st.StringToSequence("g", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(5), seq)
+
+	for seq, val := range map[uint32]string{1: "a", 2: "f", 3: "e", 4: "d", 5: "g"} {
+		assert.Equal(t, val, st.SequenceToString(seq))
+		seq2, found := st.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, seq, seq2)
+	}
+}
+
+func TestDeleteDuringResize(t *testing.T) {
+	st := New(16)
+	for i := range 8_500 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+
+	// Delete entries that have and have not been copied to the new table yet
+	for i := 0; i < 8_500; i += 2 {
+		assert.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	for i := 8_500; i < 10_000; i++ {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Zero(t, st.oldTable.len())
+
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		if i < 8_500 && i%2 == 0 {
+			assert.False(t, found, i)
+		} else {
+			assert.True(t, found, i)
+			assert.Equal(t, uint32(i+1), seq)
+		}
+	}
+}
+
+func TestDeleteChurn(t *testing.T) {
+	for _, recycle := range []bool{false, true} {
+		t.Run(strconv.FormatBool(recycle), func(t *testing.T) {
+			st := New(16)
+			st.RecycleSequences(recycle)
+
+			// Keep 1000 strings in the table, adding new ones and deleting the
+			// oldest
+			const live = 1000
+			var maxCap int
+			for i := range 100_000 {
+				st.StringToSequence(strconv.Itoa(i), true)
+				if i >= live {
+					require.True(t, st.Delete(strconv.Itoa(i-live)))
+				}
+				if i > 10*live {
+					// The table should stop growing once we've been through a
+					// few cycles
+					maxCap = max(maxCap, st.Cap())
+				}
+			}
+			assert.Equal(t, live, st.Len())
+			assert.True(t, maxCap <= 4*live*loadFactor, maxCap)
+			// Deleted strings are compacted away, so string storage doesn't
+			// grow with the number of strings ever added
+			assert.True(t, st.SymbolSize() <= 3*compactMinBytes, st.SymbolSize())
+			assert.True(t, st.Stats().IntbankBytes <= compactMinBytes, st.Stats().IntbankBytes)
+			// Compact only keeps track of slabs that still hold deleted
+			// sequence numbers, so its work doesn't grow either
+			assert.True(t, len(st.ib.runs) <= live/intbanksize+2, len(st.ib.runs))
+			if recycle {
+				assert.True(t, int(st.maxSequence) <= live+1, st.maxSequence)
+				assert.True(t, len(st.ib.slabs) <= live/intbanksize+1, len(st.ib.slabs))
+			}
+
+			for i := 100_000 - live; i < 100_000; i++ {
+				_, found := st.StringToSequence(strconv.Itoa(i), false)
+				assert.True(t, found)
+			}
+		})
+	}
+}
+
+func TestDeleteSerialize(t *testing.T) {
+	st := New(16)
+	st.RecycleSequences(true)
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	for i := 0; i < 1000; i += 3 {
+		st.Delete(strconv.Itoa(i))
+	}
+
+	var buf bytes.Buffer
+	_, err := st.WriteTo(&buf)
+	require.NoError(t, err)
+
+	var st2 SymbolTab
+	_, err = st2.ReadFrom(&buf)
+	require.NoError(t, err)
+	st2.RecycleSequences(true)
+
+	assert.Equal(t, st.Len(), st2.Len())
+	for i := range 1000 {
+		seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+		assert.Equal(t, i%3 != 0, found)
+		if found {
+			assert.Equal(t, uint32(i+1), seq)
+		}
+	}
+
+	// The free list should have survived
+	seq, found := st2.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(999+1), seq)
+	seq, found = st2.StringToSequence("cat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(996+1), seq)
+}
+
+// BenchmarkDeleteChurn adds and deletes strings while keeping 1000 in the
+// table. The time per operation should not depend on b.N, even though Delete
+// compacts the table from time to time.
+func BenchmarkDeleteChurn(b *testing.B) {
+	const live = 1000
+	vals := make([]string, live)
+	for i := range vals {
+		vals[i] = strconv.Itoa(i)
+	}
+	st := New(live)
+	for _, val := range vals {
+		st.StringToSequence(val, true)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		j := i % live
+		st.Delete(vals[j])
+		st.StringToSequence(vals[j], true)
+	}
+}
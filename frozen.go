@@ -0,0 +1,174 @@
+package symboltab
+
+import (
+	"iter"
+	"math/bits"
+	"unsafe"
+)
+
+// FrozenSymbolTab is a read-only snapshot of a SymbolTab. See FrozenTab.
+type FrozenSymbolTab = FrozenTab[uint32]
+
+// FrozenTab is a read-only snapshot of a Tab. Create one with Freeze. It cannot
+// be changed, so it is safe for any number of goroutines to use at once without
+// locking.
+//
+// A FrozenTab uses less memory than a Tab. The strings are stored
+// back to back in a single allocation, and rather than an open-addressed table
+// that is at most half full, the hash table entries are sorted by bucket with
+// an index giving the start of each bucket. There are about half as many
+// buckets as strings, so a lookup usually compares against one or two entries.
+type FrozenTab[S Sequence] struct {
+	count int
+	// mask selects the bucket from a hash
+	mask uint32
+	// The entries for bucket b are entries[starts[b]:starts[b+1]]
+	starts  []S
+	entries []tableEntry[S]
+	// The string for sequence number seq is data[offsets[seq-1]:offsets[seq]]
+	offsets []uint64
+	data    []byte
+	// deleted marks sequence numbers that were deleted when the table was
+	// frozen. It is nil if there aren't any.
+	deleted bitset
+	hash    Hash
+	seed    uintptr
+}
+
+// Freeze returns a read-only copy of the Tab. Sequence numbers are unchanged.
+// The Tab is not changed and may continue to be used, but changes to it are not
+// seen by the FrozenTab.
+func (i *Tab[S]) Freeze() *FrozenTab[S] {
+	f := &FrozenTab[S]{
+		count:   i.count,
+		offsets: make([]uint64, i.maxSequence+1),
+		hash:    i.hash,
+		seed:    i.seed,
+	}
+	if i.count != int(i.maxSequence) {
+		f.deleted = newBitset(uint64(i.maxSequence))
+	}
+
+	var size int
+	for _, val := range i.All() {
+		size += len(val)
+	}
+	f.data = make([]byte, 0, size)
+	for seq := S(1); seq <= i.maxSequence; seq++ {
+		if val, ok := i.LookupSequence(seq); ok {
+			f.data = append(f.data, val...)
+		} else {
+			f.deleted.set(uint64(seq))
+		}
+		f.offsets[seq] = uint64(len(f.data))
+	}
+
+	buckets := 1
+	if i.count > 2 {
+		buckets = 1 << bits.Len(uint(i.count-1)/2)
+	}
+	f.mask = uint32(buckets - 1)
+
+	// Sort the entries into buckets with a counting sort. First count the
+	// entries in each bucket, then turn the counts into start positions.
+	hashes := make([]uint32, 0, i.count)
+	f.starts = make([]S, buckets+1)
+	for _, val := range i.All() {
+		hash := f.hash.sum32(val, f.seed)
+		hashes = append(hashes, hash)
+		f.starts[(hash&f.mask)+1]++
+	}
+	for b := range buckets {
+		f.starts[b+1] += f.starts[b]
+	}
+	next := make([]S, buckets)
+	copy(next, f.starts)
+	f.entries = make([]tableEntry[S], i.count)
+	var j int
+	for seq := range i.All() {
+		hash := hashes[j]
+		j++
+		b := hash & f.mask
+		f.entries[next[b]] = tableEntry[S]{hash: hash, sequence: seq}
+		next[b]++
+	}
+
+	return f
+}
+
+// Len returns the number of unique strings stored
+func (f *FrozenTab[S]) Len() int {
+	return f.count
+}
+
+// Size returns the approximate number of bytes of memory used by the
+// FrozenTab
+func (f *FrozenTab[S]) Size() int {
+	return len(f.starts)*int(unsafe.Sizeof(S(0))) +
+		len(f.entries)*int(unsafe.Sizeof(tableEntry[S]{})) +
+		len(f.offsets)*8 +
+		len(f.data) +
+		len(f.deleted)*8
+}
+
+// SequenceToString looks up a string by its sequence number. It panics if seq
+// is out of range. Deleted sequence numbers return an empty string. Use
+// LookupSequence if seq may not be valid.
+func (f *FrozenTab[S]) SequenceToString(seq S) string {
+	b := f.data[f.offsets[seq-1]:f.offsets[seq]]
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// LookupSequence looks up a string by its sequence number. If seq is 0, out of
+// range or was deleted, ok is false.
+func (f *FrozenTab[S]) LookupSequence(seq S) (val string, ok bool) {
+	if seq == 0 || int(seq) >= len(f.offsets) || (f.deleted != nil && f.deleted.has(uint64(seq))) {
+		return "", false
+	}
+	return f.SequenceToString(seq), true
+}
+
+// StringToSequence looks up the string val and returns its sequence number
+// seq. found indicates whether val is present.
+func (f *FrozenTab[S]) StringToSequence(val string) (seq S, found bool) {
+	hash := f.hash.sum32(val, f.seed)
+	b := hash & f.mask
+	for _, e := range f.entries[f.starts[b]:f.starts[b+1]] {
+		if e.hash == hash && f.SequenceToString(e.sequence) == val {
+			return e.sequence, true
+		}
+	}
+	return 0, false
+}
+
+// BytesToSequence is like StringToSequence, but takes a byte slice. It does not
+// allocate.
+func (f *FrozenTab[S]) BytesToSequence(val []byte) (seq S, found bool) {
+	return f.StringToSequence(unsafe.String(unsafe.SliceData(val), len(val)))
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// FrozenTab, in sequence order. Deleted sequence numbers are skipped.
+func (f *FrozenTab[S]) All() iter.Seq2[S, string] {
+	return func(yield func(S, string) bool) {
+		for seq := S(1); int(seq) < len(f.offsets); seq++ {
+			if val, ok := f.LookupSequence(seq); ok {
+				if !yield(seq, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Strings returns an iterator over the strings in the FrozenTab, in sequence
+// order
+func (f *FrozenTab[S]) Strings() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, val := range f.All() {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
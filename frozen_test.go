@@ -0,0 +1,171 @@
+package symboltab
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeze(t *testing.T) {
+	st := New(16)
+	// 8,500 entries leaves the table part way through a resize
+	const n = 8_500
+	for i := range n {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+	for i := 0; i < n; i += 5 {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+
+	f := st.Freeze()
+	assert.Equal(t, st.Len(), f.Len())
+	for i := range n {
+		val := strconv.Itoa(i)
+		seq, found := f.StringToSequence(val)
+		got, ok := f.LookupSequence(uint32(i + 1))
+		if i%5 == 0 {
+			assert.False(t, found)
+			assert.False(t, ok)
+			continue
+		}
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.True(t, ok)
+		assert.Equal(t, val, got)
+		assert.Equal(t, val, f.SequenceToString(seq))
+
+		seq, found = f.BytesToSequence([]byte(val))
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	_, found := f.StringToSequence("hat")
+	assert.False(t, found)
+	_, ok := f.LookupSequence(0)
+	assert.False(t, ok)
+	_, ok = f.LookupSequence(n + 1)
+	assert.False(t, ok)
+
+	var count int
+	for seq, val := range f.All() {
+		assert.Equal(t, st.SequenceToString(seq), val)
+		count++
+	}
+	assert.Equal(t, st.Len(), count)
+
+	// Changes to the SymbolTab are not seen by the FrozenSymbolTab
+	st.StringToSequence("hat", true)
+	_, found = f.StringToSequence("hat")
+	assert.False(t, found)
+}
+
+func TestFreezeEmpty(t *testing.T) {
+	var st SymbolTab
+	f := st.Freeze()
+	assert.Zero(t, f.Len())
+	_, found := f.StringToSequence("hat")
+	assert.False(t, found)
+	_, ok := f.LookupSequence(1)
+	assert.False(t, ok)
+}
+
+func TestFreezeSize(t *testing.T) {
+	st := New(16)
+	for i := range 100_000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	liveSize := st.table.len()*8 + st.oldTable.len()*8 + len(st.ib.slabs)*intbanksize*8 + st.SymbolSize()
+
+	f := st.Freeze()
+	assert.True(t, f.Size() < liveSize*3/4, "frozen %d, live %d", f.Size(), liveSize)
+}
+
+func TestFreezeConcurrent(t *testing.T) {
+	st := New(16)
+	for i := range 10_000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	f := st.Freeze()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 10_000 {
+				val := strconv.Itoa(i)
+				seq, found := f.StringToSequence(val)
+				if !assert.True(t, found) || !assert.Equal(t, val, f.SequenceToString(seq)) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkFrozenExisting(b *testing.B) {
+	st := New(b.N)
+	values := make([]string, b.N)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+		st.StringToSequence(values[i], true)
+	}
+	f := st.Freeze()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var seq uint32
+	for _, val := range values {
+		seq, _ = f.StringToSequence(val)
+	}
+
+	if f.SequenceToString(seq) != strconv.Itoa(b.N-1) {
+		b.Errorf("last symbol doesn't match - get %s", f.SequenceToString(seq))
+	}
+}
+
+func BenchmarkFrozenMiss(b *testing.B) {
+	st := New(b.N)
+	for i := range b.N {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	f := st.Freeze()
+	values := make([]string, b.N)
+	for i := range values {
+		values[i] = strconv.Itoa(b.N + i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for _, val := range values {
+		if _, found := f.StringToSequence(val); found {
+			b.Errorf("found value %s", val)
+		}
+	}
+}
+
+func BenchmarkFrozenParallel(b *testing.B) {
+	st := New(100_000)
+	values := make([]string, 100_000)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+		st.StringToSequence(values[i], true)
+	}
+	f := st.Freeze()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			f.StringToSequence(values[i%len(values)])
+			i++
+		}
+	})
+}
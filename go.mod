@@ -5,9 +5,12 @@ go 1.24
 require (
 	github.com/philpearl/stringbank v1.1.0
 	github.com/stretchr/testify v1.3.0
+	github.com/zeebo/xxh3 v1.1.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
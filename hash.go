@@ -0,0 +1,107 @@
+package symboltab
+
+import (
+	"errors"
+	"hash/maphash"
+	"math/rand/v2"
+	"unsafe"
+
+	"github.com/philpearl/symboltab/internal/wyhash"
+	"github.com/zeebo/xxh3"
+)
+
+// Hash is a hash function for a SymbolTab. Choose one of the predefined hash
+// functions, or make your own with HashCustom, and pass it to NewWithHash. The
+// zero value is HashRuntime.
+//
+// Only the bottom 32 bits of the hash are used.
+type Hash struct {
+	id   uint32
+	name string
+	sum  func(val string) uint64
+}
+
+const (
+	hashRuntime uint32 = iota
+	hashMaphash
+	hashXXH3
+	hashWyhash
+	hashCustom
+)
+
+var (
+	// HashRuntime is the Go runtime's string hash, the same as Go's maps use. It
+	// is the fastest, and is the default. Each table has its own random seed, so
+	// the hash values can't be predicted by anyone who can choose the strings to
+	// add. They are also different in each process,
+	// so a serialized table has to be rehashed when it is read.
+	HashRuntime = Hash{id: hashRuntime, name: "runtime"}
+	// HashMaphash uses hash/maphash with a seed that is fixed for the life of
+	// the process. Like HashRuntime its values are different in each process.
+	HashMaphash = Hash{id: hashMaphash, name: "maphash", sum: maphashString}
+	// HashXXH3 is the 64 bit XXH3 hash. Its values are the same in every process.
+	HashXXH3 = Hash{id: hashXXH3, name: "xxh3", sum: xxh3.HashString}
+	// HashWyhash is wyhash. Its values are the same in every process.
+	HashWyhash = Hash{id: hashWyhash, name: "wyhash", sum: wyhash.String}
+)
+
+// ErrHashMismatch is returned by ReadFrom if the SymbolTab was written with a
+// different hash function to the one the reading SymbolTab is using
+var ErrHashMismatch = errors.New("symboltab: serialized with a different hash function")
+
+// HashCustom makes a Hash from fn. name identifies the hash function in
+// serialized tables, so that ReadFrom can check a table is read back with the
+// same hash function. fn must not modify or keep the slice it is passed.
+func HashCustom(name string, fn func([]byte) uint64) Hash {
+	return Hash{
+		id:   hashCustom,
+		name: name,
+		sum: func(val string) uint64 {
+			return fn(unsafe.Slice(unsafe.StringData(val), len(val)))
+		},
+	}
+}
+
+// String returns the name of the hash function
+func (h Hash) String() string {
+	if h.name == "" {
+		return HashRuntime.name
+	}
+	return h.name
+}
+
+// equal returns true if h and o are the same hash function, as far as we can
+// tell
+func (h Hash) equal(o Hash) bool {
+	return h.id == o.id && (h.id != hashCustom || h.name == o.name)
+}
+
+// sum32 returns the hash of val for use in the table. seed is only used by
+// HashRuntime. The other hash functions are either seeded once per process or
+// are intended to be the same in every process.
+func (h Hash) sum32(val string, seed uintptr) uint32 {
+	if h.sum == nil {
+		return stringHash(val, seed)
+	}
+	return uint32(h.sum(val))
+}
+
+var maphashSeed = maphash.MakeSeed()
+
+// newSeed returns a random seed for HashRuntime. It is never 0, so we can use 0
+// to mean we haven't chosen a seed yet.
+func newSeed() uintptr {
+	return uintptr(rand.Uint64()) | 1
+}
+
+func maphashString(val string) uint64 {
+	return maphash.String(maphashSeed, val)
+}
+
+// NewWithHash creates a new SymbolTab that uses the hash function hash. cap is
+// the initial capacity of the table.
+func NewWithHash(cap int, hash Hash) *SymbolTab {
+	st := New(cap)
+	st.hash = hash
+	return st
+}
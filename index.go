@@ -0,0 +1,166 @@
+package symboltab
+
+import (
+	"iter"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// index is a secondary index of the strings in a SymbolTab, sorted
+// lexicographically. It is built the first time it is needed. After that we
+// note strings that are added or deleted, and fold them in the next time the
+// index is used.
+type index[S Sequence] struct {
+	sorted  []S
+	added   []S
+	deleted []S
+}
+
+// PrefixScan returns an iterator over the strings in the SymbolTab that start
+// with prefix, and their sequence numbers, in lexicographic order.
+//
+// The first scan builds a sorted index of all the strings, which takes time
+// proportional to Len() * log(Len()). Adding and deleting strings only notes
+// the change. The next scan merges the changes into a new copy of the index,
+// which takes time proportional to Len() plus k * log(k) for k changes, and
+// allocates space for Len() sequence numbers. A scan with no changes since the
+// last costs roughly log(Len()) plus the number of matches. So scans are cheap
+// when they are much more frequent than changes, or when changes come in
+// batches between scans. The SymbolTab must not be changed during iteration.
+func (i *Tab[S]) PrefixScan(prefix string) iter.Seq2[S, string] {
+	return func(yield func(S, string) bool) {
+		sorted := i.sortedIndex()
+		start := sort.Search(len(sorted), func(j int) bool {
+			return i.SequenceToString(sorted[j]) >= prefix
+		})
+		for _, seq := range sorted[start:] {
+			val := i.SequenceToString(seq)
+			if !strings.HasPrefix(val, prefix) || !yield(seq, val) {
+				return
+			}
+		}
+	}
+}
+
+// RangeScan returns an iterator over the strings in the SymbolTab that are
+// greater than or equal to start and less than end, and their sequence numbers,
+// in lexicographic order. If end is empty there is no upper limit. RangeScan
+// uses the same index as PrefixScan.
+func (i *Tab[S]) RangeScan(start, end string) iter.Seq2[S, string] {
+	return func(yield func(S, string) bool) {
+		sorted := i.sortedIndex()
+		first := sort.Search(len(sorted), func(j int) bool {
+			return i.SequenceToString(sorted[j]) >= start
+		})
+		for _, seq := range sorted[first:] {
+			val := i.SequenceToString(seq)
+			if (end != "" && val >= end) || !yield(seq, val) {
+				return
+			}
+		}
+	}
+}
+
+// DropIndex releases the index used by PrefixScan and RangeScan. It will be
+// rebuilt if either is called again.
+func (i *Tab[S]) DropIndex() {
+	i.index = nil
+}
+
+// indexAdd notes that seq has been added, if there's an index
+func (i *Tab[S]) indexAdd(seq S) {
+	if i.index != nil {
+		i.index.added = append(i.index.added, seq)
+	}
+}
+
+// indexDelete notes that seq has been deleted, if there's an index
+func (i *Tab[S]) indexDelete(seq S) {
+	if i.index != nil {
+		i.index.deleted = append(i.index.deleted, seq)
+	}
+}
+
+// sortedIndex returns an up-to-date list of sequence numbers sorted by their
+// strings. The slice is never changed once returned, so it remains safe to
+// iterate over.
+func (i *Tab[S]) sortedIndex() []S {
+	compare := func(a, b S) int {
+		return strings.Compare(i.SequenceToString(a), i.SequenceToString(b))
+	}
+
+	if i.index == nil {
+		sorted := make([]S, 0, i.count)
+		for seq := range i.All() {
+			sorted = append(sorted, seq)
+		}
+		slices.SortFunc(sorted, compare)
+		i.index = &index[S]{sorted: sorted}
+		return sorted
+	}
+
+	x := i.index
+	if len(x.added) == 0 && len(x.deleted) == 0 {
+		return x.sorted
+	}
+
+	// A sequence number may be deleted and then reused, perhaps more than once,
+	// so we remove everything that has been deleted from the existing index,
+	// and only keep additions that are still present.
+	kept := x.sorted
+	if len(x.deleted) != 0 {
+		deleted := make(map[S]struct{}, len(x.deleted))
+		for _, seq := range x.deleted {
+			deleted[seq] = struct{}{}
+		}
+		kept = make([]S, 0, len(x.sorted))
+		for _, seq := range x.sorted {
+			if _, ok := deleted[seq]; !ok {
+				kept = append(kept, seq)
+			}
+		}
+	}
+
+	slices.Sort(x.added)
+	added := slices.Compact(x.added)
+	added = slices.DeleteFunc(added, func(seq S) bool {
+		_, ok := i.LookupSequence(seq)
+		return !ok
+	})
+	slices.SortFunc(added, compare)
+
+	// Merge the new entries in
+	sorted := make([]S, 0, len(kept)+len(added))
+	for len(kept) > 0 && len(added) > 0 {
+		if compare(kept[0], added[0]) < 0 {
+			sorted = append(sorted, kept[0])
+			kept = kept[1:]
+		} else {
+			sorted = append(sorted, added[0])
+			added = added[1:]
+		}
+	}
+	sorted = append(sorted, kept...)
+	sorted = append(sorted, added...)
+
+	x.sorted = sorted
+	x.added = x.added[:0]
+	x.deleted = x.deleted[:0]
+	return sorted
+}
+
+// bitset is a set of sequence numbers
+type bitset []uint64
+
+func newBitset(max uint64) bitset {
+	return make(bitset, max/64+1)
+}
+
+func (b bitset) set(seq uint64) {
+	b[seq/64] |= 1 << (seq % 64)
+}
+
+func (b bitset) has(seq uint64) bool {
+	return b[seq/64]&(1<<(seq%64)) != 0
+}
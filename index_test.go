@@ -0,0 +1,148 @@
+package symboltab
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect(seq func(yield func(uint32, string) bool)) (seqs []uint32, vals []string) {
+	for seq, val := range seq {
+		seqs = append(seqs, seq)
+		vals = append(vals, val)
+	}
+	return seqs, vals
+}
+
+func TestPrefixScan(t *testing.T) {
+	st := New(16)
+	for _, val := range []string{"user:b", "group:a", "user:a", "user", "usex", "user:c"} {
+		st.StringToSequence(val, true)
+	}
+
+	seqs, vals := collect(st.PrefixScan("user:"))
+	assert.Equal(t, []string{"user:a", "user:b", "user:c"}, vals)
+	assert.Equal(t, []uint32{3, 1, 6}, seqs)
+
+	_, vals = collect(st.PrefixScan("use"))
+	assert.Equal(t, []string{"user", "user:a", "user:b", "user:c", "usex"}, vals)
+
+	_, vals = collect(st.PrefixScan("zzz"))
+	assert.Empty(t, vals)
+
+	_, vals = collect(st.PrefixScan(""))
+	assert.Len(t, vals, 6)
+
+	// The index is kept up to date
+	st.StringToSequence("user:0", true)
+	st.StringToSequence("user:bb", true)
+	require.True(t, st.Delete("user:b"))
+	_, vals = collect(st.PrefixScan("user:"))
+	assert.Equal(t, []string{"user:0", "user:a", "user:bb", "user:c"}, vals)
+
+	// Stopping early
+	for _, val := range st.PrefixScan("user:") {
+		assert.Equal(t, "user:0", val)
+		break
+	}
+}
+
+func TestRangeScan(t *testing.T) {
+	st := New(16)
+	for i := range 100 {
+		st.StringToSequence(fmt.Sprintf("%03d", i), true)
+	}
+
+	seqs, vals := collect(st.RangeScan("010", "015"))
+	assert.Equal(t, []string{"010", "011", "012", "013", "014"}, vals)
+	assert.Equal(t, []uint32{11, 12, 13, 14, 15}, seqs)
+
+	_, vals = collect(st.RangeScan("0955", ""))
+	assert.Equal(t, []string{"096", "097", "098", "099"}, vals)
+
+	_, vals = collect(st.RangeScan("050", "050"))
+	assert.Empty(t, vals)
+
+	_, vals = collect(st.RangeScan("", "002"))
+	assert.Equal(t, []string{"000", "001"}, vals)
+}
+
+func TestIndexChurn(t *testing.T) {
+	// Check the index against a brute force scan while adding, deleting and
+	// reusing sequence numbers
+	st := New(16)
+	st.RecycleSequences(true)
+	check := func() {
+		t.Helper()
+		var want []string
+		for val := range st.Strings() {
+			if strings.HasPrefix(val, "1") {
+				want = append(want, val)
+			}
+		}
+		sort.Strings(want)
+		seqs, vals := collect(st.PrefixScan("1"))
+		assert.Equal(t, want, vals)
+		for j, seq := range seqs {
+			assert.Equal(t, vals[j], st.SequenceToString(seq))
+		}
+	}
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	check()
+	for round := range 5 {
+		for i := round; i < 1000; i += 7 {
+			st.Delete(strconv.Itoa(i))
+		}
+		for i := range 200 {
+			st.StringToSequence(strconv.Itoa(1000*(round+1)+i), true)
+			if i%3 == 0 {
+				// delete something we've just added, so its sequence number is
+				// reused straight away
+				st.Delete(strconv.Itoa(1000*(round+1) + i))
+			}
+		}
+		check()
+	}
+
+	st.DropIndex()
+	check()
+
+	n := st.Len()
+	_, vals := collect(st.RangeScan("", ""))
+	assert.Len(t, vals, n)
+	assert.True(t, slices.IsSorted(vals))
+}
+
+func BenchmarkPrefixScan(b *testing.B) {
+	st := New(1_000_000)
+	for i := range 1_000_000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	// Build the index
+	for range st.PrefixScan("") {
+		break
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var count int
+	for i := range b.N {
+		// Each prefix matches 11 strings
+		for range st.PrefixScan(strconv.Itoa(100_000 + i%900_000)[:5]) {
+			count++
+		}
+	}
+	if count != 11*b.N {
+		b.Errorf("expected %d matches, got %d", 11*b.N, count)
+	}
+}
@@ -0,0 +1,90 @@
+package symboltab
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsert(t *testing.T) {
+	var st SymbolTab
+	for i := range 1000 {
+		seq, found, err := st.Insert(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	for i := range 1000 {
+		seq, found, err := st.Insert(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+}
+
+func TestInsertFull(t *testing.T) {
+	st := New(16)
+	st.StringToSequence("a", true)
+	st.maxSequence = tombstone[uint32]() - 1
+
+	_, _, err := st.Insert("b")
+	assert.True(t, errors.Is(err, ErrFull))
+	assert.Equal(t, 1, st.Len())
+	_, found := st.StringToSequence("b", false)
+	assert.False(t, found)
+
+	seq, found, err := st.Insert("a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+}
+
+func TestFindInTableFull(t *testing.T) {
+	var st SymbolTab
+	full := table[uint32]{entries: make([]tableEntry[uint32], 16)}
+	for j := range full.entries {
+		full.entries[j] = tableEntry[uint32]{hash: uint32(j), sequence: uint32(j + 1)}
+	}
+	cursor, seq := st.findInTable(full, "a", 1<<16+3)
+	assert.Equal(t, -1, cursor)
+	assert.Zero(t, seq)
+}
+
+func TestInsertMaxTableLen(t *testing.T) {
+	defer func(l int) { maxTableLen = l }(maxTableLen)
+	maxTableLen = 64
+
+	var st SymbolTab
+	var err error
+	var n int
+	for n = 0; err == nil; n++ {
+		_, _, err = st.Insert(strconv.Itoa(n))
+	}
+	assert.True(t, errors.Is(err, ErrFull))
+	// The table stops growing, then fills up to 3/4 full
+	assert.Equal(t, 64, st.Cap())
+	assert.Equal(t, 48, st.Len())
+	assert.Equal(t, 49, n)
+	for i := range 48 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		require.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+
+	// Deleting strings leaves tombstones, which take space until there are
+	// few enough live strings for the tombstones to be cleared out
+	require.True(t, st.Delete("0"))
+	_, _, err = st.Insert("hat")
+	assert.True(t, errors.Is(err, ErrFull))
+	for i := 1; i < 40; i++ {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	seq, found, err := st.Insert("hat")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, uint32(49), seq)
+	assert.Equal(t, 64, st.Cap())
+}
@@ -1,12 +1,32 @@
 package symboltab
 
+import "slices"
+
 const intbanksize = 1 << 9
 
-type intbank struct {
+// intbank maps sequence numbers to stringbank offsets. Offsets are never
+// negative, so we use negative values to mark deleted sequence numbers. The
+// value for a deleted sequence number is -1 - the next deleted sequence number,
+// which links them into a free list.
+type intbank[S Sequence] struct {
 	slabs [][]int
+	// changed marks the slabs in which sequence numbers have been deleted or
+	// taken off the free list since releaseDeleted last ran, and
+	// changedSlabs lists them.
+	changed      []bool
+	changedSlabs []int
+	// runs is the free list as releaseDeleted left it. See there.
+	runs []freeRun[S]
+}
+
+// freeRun is the part of the free list that lies within one slab, which runs
+// from first to last
+type freeRun[S Sequence] struct {
+	slab        int
+	first, last S
 }
 
-func (ib *intbank) save(sequence uint32, offset int) {
+func (ib *intbank[S]) save(sequence S, offset int) {
 	sequence-- // externally sequence starts at 1
 	slabNo := int(sequence / intbanksize)
 	slabOffset := int(sequence % intbanksize)
@@ -18,10 +38,127 @@ func (ib *intbank) save(sequence uint32, offset int) {
 	ib.slabs[slabNo][slabOffset] = offset
 }
 
-func (ib *intbank) lookup(sequence uint32) int {
+// preallocate allocates slabs for the first n sequence numbers
+func (ib *intbank[S]) preallocate(n int) {
+	for len(ib.slabs)*intbanksize < n {
+		ib.slabs = append(ib.slabs, make([]int, intbanksize))
+	}
+}
+
+func (ib *intbank[S]) lookup(sequence S) int {
 	sequence-- // externally, sequence starts at 1
 	slabNo := int(sequence / intbanksize)
 	slabOffset := int(sequence % intbanksize)
 
 	return ib.slabs[slabNo][slabOffset]
 }
+
+// delete marks sequence as deleted. next is the next entry in the free list, or 0
+func (ib *intbank[S]) delete(sequence S, next S) {
+	ib.save(sequence, -1-int(next))
+	ib.markChanged(sequence)
+}
+
+// nextFree returns the sequence number following the deleted sequence in the
+// free list
+func (ib *intbank[S]) nextFree(sequence S) S {
+	return S(-1 - ib.lookup(sequence))
+}
+
+// takeFree takes sequence, which is the head of the free list, off the list
+// so it can be reused. It returns the new head.
+func (ib *intbank[S]) takeFree(sequence S) S {
+	ib.markChanged(sequence)
+	return ib.nextFree(sequence)
+}
+
+func (ib *intbank[S]) markChanged(sequence S) {
+	slabNo := int((sequence - 1) / intbanksize)
+	for len(ib.changed) <= slabNo {
+		ib.changed = append(ib.changed, false)
+	}
+	if !ib.changed[slabNo] {
+		ib.changed[slabNo] = true
+		ib.changedSlabs = append(ib.changedSlabs, slabNo)
+	}
+}
+
+// deletedSlab stands in for slabs in which every sequence number has been
+// deleted. It is shared, and is never written to.
+var deletedSlab = func() []int {
+	s := make([]int, intbanksize)
+	for j := range s {
+		s[j] = -1
+	}
+	return s
+}()
+
+func isDeletedSlab(slab []int) bool {
+	return &slab[0] == &deletedSlab[0]
+}
+
+// releaseDeleted replaces slabs in which every sequence number up to max has
+// been deleted with deletedSlab, and rebuilds the free list from the deleted
+// sequence numbers that are left. Sequence numbers in released slabs are not on
+// the new free list, so are never reused. It returns the head of the new free
+// list and the number of slabs released.
+//
+// The new free list is in order, lowest first, so it is a run of sequence
+// numbers from each slab in turn. A slab that hasn't changed since the last
+// call still holds its run intact, so we only scan the slabs that have
+// changed and then link all the runs together. This takes time proportional
+// to the number of slabs holding deleted sequence numbers, however large max
+// has grown.
+func (ib *intbank[S]) releaseDeleted(max S) (freeList S, released int) {
+	slices.Sort(ib.changedSlabs)
+	runs := make([]freeRun[S], 0, len(ib.runs)+len(ib.changedSlabs))
+	old := ib.runs
+	for _, slabNo := range ib.changedSlabs {
+		ib.changed[slabNo] = false
+		for len(old) > 0 && old[0].slab <= slabNo {
+			if old[0].slab < slabNo {
+				runs = append(runs, old[0])
+			}
+			old = old[1:]
+		}
+
+		slab := ib.slabs[slabNo]
+		n := min(int(max)-slabNo*intbanksize, intbanksize)
+		deleted := 0
+		for _, offset := range slab[:n] {
+			if offset < 0 {
+				deleted++
+			}
+		}
+		if deleted == intbanksize {
+			ib.slabs[slabNo] = deletedSlab
+			released++
+			continue
+		}
+		if deleted == 0 {
+			continue
+		}
+
+		// Link the deleted sequence numbers in the slab lowest first
+		run := freeRun[S]{slab: slabNo}
+		for j := n - 1; j >= 0; j-- {
+			if slab[j] < 0 {
+				seq := S(slabNo*intbanksize + j + 1)
+				if run.last == 0 {
+					run.last = seq
+				}
+				slab[j] = -1 - int(run.first)
+				run.first = seq
+			}
+		}
+		runs = append(runs, run)
+	}
+	runs = append(runs, old...)
+	ib.runs, ib.changedSlabs = runs, ib.changedSlabs[:0]
+
+	for j := len(runs) - 1; j >= 0; j-- {
+		ib.save(runs[j].last, -1-int(freeList))
+		freeList = runs[j].first
+	}
+	return freeList, released
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestIntbank(t *testing.T) {
-	ib := intbank{}
+	ib := intbank[uint32]{}
 	ib.save(1, 37)
 	ib.save(2, 43)
 
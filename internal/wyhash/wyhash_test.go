@@ -0,0 +1,47 @@
+package wyhash
+
+import (
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// Test vectors from the reference implementation. The seed is the index
+	// into the list.
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0x42bc986dc5eec4d3},
+		{"a", 0x84508dc903c31551},
+		{"abc", 0x0bc54887cfc9ecb1},
+		{"message digest", 0x6e2ff3298208a67c},
+		{"abcdefghijklmnopqrstuvwxyz", 0x9a64e42e897195b9},
+	}
+	for seed, test := range tests {
+		if got := Hash([]byte(test.in), uint64(seed)); got != test.want {
+			t.Errorf("%q: got %#x, want %#x", test.in, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	// Cover each length up to a few blocks, and check the string and byte
+	// versions agree and that every byte affects the hash
+	buf := make([]byte, 200)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	for l := range len(buf) {
+		h := Hash(buf[:l], 0)
+		if got := String(string(buf[:l])); got != h {
+			t.Fatalf("length %d: String gives %#x, Hash gives %#x", l, got, h)
+		}
+		for j := range l {
+			buf[j] ^= 1
+			if Hash(buf[:l], 0) == h {
+				t.Errorf("length %d: changing byte %d does not change the hash", l, j)
+			}
+			buf[j] ^= 1
+		}
+	}
+}
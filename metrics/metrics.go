@@ -0,0 +1,227 @@
+// Package metrics exports statistics about symbol tables via expvar and in the
+// Prometheus text format.
+//
+// Register each table with a Registry under a name, then either publish the
+// Registry with expvar or serve its Handler to Prometheus.
+//
+//	reg := metrics.NewRegistry()
+//	reg.Register("users", st)
+//	reg.Publish("symboltab")
+//	http.Handle("/metrics", reg.Handler())
+//
+// The Registry calls Stats on each table whenever it is read. SymbolTab is not
+// safe for concurrent use, so if a table may be written to at the same time,
+// register a SourceFunc that takes whatever lock guards the writes.
+package metrics
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/philpearl/symboltab"
+)
+
+// Source is a symbol table that can report its statistics. *symboltab.SymbolTab
+// is a Source. offheap.Stats has the same fields as symboltab.Stats, so an
+// *offheap.SymbolTab can be registered with a SourceFunc that converts them.
+//
+//	reg.Register("offheap", metrics.SourceFunc(func() symboltab.Stats {
+//		return symboltab.Stats(st.Stats())
+//	}))
+type Source interface {
+	Stats() symboltab.Stats
+}
+
+// SourceFunc lets you use a function as a Source.
+type SourceFunc func() symboltab.Stats
+
+// Stats calls f
+func (f SourceFunc) Stats() symboltab.Stats {
+	return f()
+}
+
+// Registry is a set of named symbol tables to report on. A Registry is safe for
+// concurrent use. Allocate it via NewRegistry()
+type Registry struct {
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// NewRegistry creates a new, empty Registry
+func NewRegistry() *Registry {
+	return &Registry{sources: make(map[string]Source)}
+}
+
+// Register adds the table src to the Registry as name. The name is used as the
+// value of the table label in Prometheus output, and as the key in expvar
+// output. Register returns an error if name is already registered.
+func (r *Registry) Register(name string, src Source) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sources[name]; ok {
+		return fmt.Errorf("metrics: table %q already registered", name)
+	}
+	r.sources[name] = src
+	return nil
+}
+
+// Unregister removes the table registered as name. It does nothing if there is
+// no such table.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sources, name)
+}
+
+type namedStats struct {
+	name  string
+	stats symboltab.Stats
+}
+
+// collect gets the stats for each table, in name order
+func (r *Registry) collect() []namedStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make([]namedStats, 0, len(r.sources))
+	for name, src := range r.sources {
+		all = append(all, namedStats{name: name, stats: src.Stats()})
+	}
+	slices.SortFunc(all, func(a, b namedStats) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return all
+}
+
+// Publish publishes the Registry with expvar as name. The value is a JSON
+// object with a member for each table, holding its symboltab.Stats. Like
+// expvar.Publish, it panics if name is already in use.
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		all := r.collect()
+		m := make(map[string]symboltab.Stats, len(all))
+		for _, n := range all {
+			m[n.name] = n.stats
+		}
+		return m
+	}))
+}
+
+// Handler returns an http.Handler that serves the statistics for all the
+// registered tables in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// metric is a Prometheus metric with one value per table
+type metric struct {
+	name  string
+	typ   string
+	help  string
+	value func(s *symboltab.Stats) float64
+}
+
+var metrics = []metric{
+	{"symboltab_strings", "gauge", "Number of strings stored.", func(s *symboltab.Stats) float64 { return float64(s.Len) }},
+	{"symboltab_table_entries", "gauge", "Number of entries in the hash table.", func(s *symboltab.Stats) float64 { return float64(s.Cap) }},
+	{"symboltab_tombstones", "gauge", "Number of hash table entries marking deleted strings.", func(s *symboltab.Stats) float64 { return float64(s.Tombstones) }},
+	{"symboltab_load_factor", "gauge", "Fraction of the hash table in use, including tombstones.", func(s *symboltab.Stats) float64 { return s.LoadFactor }},
+	{"symboltab_resizes_total", "counter", "Number of times the hash table has been replaced.", func(s *symboltab.Stats) float64 { return float64(s.Resizes) }},
+	{"symboltab_resizing", "gauge", "1 if the hash table is part way through growing.", func(s *symboltab.Stats) float64 { return b2f(s.Resizing) }},
+	{"symboltab_sampled_entries", "gauge", "Number of hash table entries sampled for the probe statistics.", func(s *symboltab.Stats) float64 { return float64(s.Sampled) }},
+	{"symboltab_max_probe_length", "gauge", "Most entries stepped over to find any sampled string.", func(s *symboltab.Stats) float64 { return float64(s.MaxProbe) }},
+	{"symboltab_hash_collisions", "gauge", "Number of sampled strings whose hash matches an earlier string.", func(s *symboltab.Stats) float64 { return float64(s.Collisions) }},
+	{"symboltab_long_probes_total", "counter", "Number of lookups that stepped over more entries than the probe limit.", func(s *symboltab.Stats) float64 { return float64(s.LongProbes) }},
+	{"symboltab_longest_probe_length", "gauge", "Most entries stepped over by any lookup.", func(s *symboltab.Stats) float64 { return float64(s.LongestProbe) }},
+}
+
+// memoryAreas are the values of the area label for symboltab_memory_bytes
+var memoryAreas = []struct {
+	area  string
+	value func(s *symboltab.Stats) int
+}{
+	{"table", func(s *symboltab.Stats) int { return s.TableBytes }},
+	{"old_table", func(s *symboltab.Stats) int { return s.OldTableBytes }},
+	{"intbank", func(s *symboltab.Stats) int { return s.IntbankBytes }},
+	{"strings", func(s *symboltab.Stats) int { return s.StringBytes }},
+}
+
+// WriteText writes the statistics for all the registered tables to w in the
+// Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	all := r.collect()
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		writeHeader(&buf, m.name, m.typ, m.help)
+		for i := range all {
+			writeSample(&buf, m.name, all[i].name, "", "", m.value(&all[i].stats))
+		}
+	}
+
+	writeHeader(&buf, "symboltab_memory_bytes", "gauge", "Memory used by each part of the table.")
+	for i := range all {
+		for _, a := range memoryAreas {
+			writeSample(&buf, "symboltab_memory_bytes", all[i].name, "area", a.area, float64(a.value(&all[i].stats)))
+		}
+	}
+
+	// The probe histogram isn't a Prometheus histogram as we don't have the
+	// sum of the probe lengths, but we follow the same convention of cumulative
+	// counts with an upper bound in the le label.
+	writeHeader(&buf, "symboltab_probe_lengths", "gauge", "Number of sampled strings found by stepping over at most le entries.")
+	for i := range all {
+		var total int
+		for bucket, count := range all[i].stats.ProbeHistogram {
+			total += count
+			le := "+Inf"
+			if bucket < len(all[i].stats.ProbeHistogram)-1 {
+				le = strconv.Itoa(1<<bucket - 1)
+			}
+			writeSample(&buf, "symboltab_probe_lengths", all[i].name, "le", le, float64(total))
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeHeader(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(buf *bytes.Buffer, name, table, label, labelValue string, value float64) {
+	buf.WriteString(name)
+	buf.WriteString(`{table="`)
+	buf.WriteString(escapeLabel(table))
+	if label != "" {
+		buf.WriteString(`",`)
+		buf.WriteString(label)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabel(labelValue))
+	}
+	buf.WriteString(`"} `)
+	buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/philpearl/symboltab"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	st := symboltab.New(16)
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	st.Delete("37")
+
+	var mu sync.Mutex
+	other := symboltab.New(0)
+
+	reg := NewRegistry()
+	require.NoError(t, reg.Register("users", st))
+	require.NoError(t, reg.Register(`odd "name"`, SourceFunc(func() symboltab.Stats {
+		mu.Lock()
+		defer mu.Unlock()
+		return other.Stats()
+	})))
+	assert.Error(t, reg.Register("users", st))
+
+	srv := httptest.NewServer(reg.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	s := st.Stats()
+	lines := strings.Split(string(body), "\n")
+	for _, expected := range []string{
+		"# HELP symboltab_strings Number of strings stored.",
+		"# TYPE symboltab_strings gauge",
+		`symboltab_strings{table="odd \"name\""} 0`,
+		`symboltab_strings{table="users"} 999`,
+		`symboltab_table_entries{table="users"} 2048`,
+		`symboltab_tombstones{table="users"} 1`,
+		`symboltab_load_factor{table="users"} 0.48828125`,
+		"# TYPE symboltab_resizes_total counter",
+		`symboltab_resizes_total{table="users"} 6`,
+		`symboltab_resizing{table="users"} 0`,
+		`symboltab_sampled_entries{table="users"} 2048`,
+		`symboltab_max_probe_length{table="users"} ` + strconv.Itoa(s.MaxProbe),
+		`symboltab_hash_collisions{table="users"} ` + strconv.Itoa(s.Collisions),
+		`symboltab_long_probes_total{table="users"} 0`,
+		`symboltab_longest_probe_length{table="users"} 0`,
+		`symboltab_memory_bytes{table="users",area="table"} 16384`,
+		`symboltab_memory_bytes{table="users",area="old_table"} 0`,
+		`symboltab_memory_bytes{table="users",area="strings"} ` + strconv.Itoa(s.StringBytes),
+		`symboltab_probe_lengths{table="users",le="0"} ` + strconv.Itoa(s.ProbeHistogram[0]),
+		`symboltab_probe_lengths{table="users",le="1"} ` + strconv.Itoa(s.ProbeHistogram[0]+s.ProbeHistogram[1]),
+		`symboltab_probe_lengths{table="users",le="+Inf"} 999`,
+		`symboltab_probe_lengths{table="odd \"name\"",le="+Inf"} 0`,
+	} {
+		assert.Contains(t, lines, expected)
+	}
+
+	// Every line is a comment or a sample, and each metric has a HELP and TYPE
+	// before its samples
+	described := map[string]bool{}
+	for _, line := range lines[:len(lines)-1] {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			described[strings.Fields(name)[0]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		name, _, ok := strings.Cut(line, "{")
+		require.True(t, ok, line)
+		assert.True(t, described[name], line)
+	}
+	assert.Equal(t, "", lines[len(lines)-1])
+
+	// Once a table is unregistered it is no longer reported
+	reg.Unregister("users")
+	var buf strings.Builder
+	require.NoError(t, reg.WriteText(&buf))
+	assert.NotContains(t, buf.String(), `table="users"`)
+}
+
+func TestPublish(t *testing.T) {
+	st := symboltab.New(16)
+	for i := range 100 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	reg := NewRegistry()
+	require.NoError(t, reg.Register("users", st))
+	reg.Publish("symboltab_test")
+
+	var m map[string]symboltab.Stats
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("symboltab_test").String()), &m))
+	assert.Len(t, m, 1)
+	assert.Equal(t, st.Stats(), m["users"])
+}
@@ -1,27 +1,32 @@
 package symboltab
 
+import "iter"
+
 // Naive implementation of the same function. Really just intended to compare against
 type Naive struct {
-	m map[string]int32
+	m map[string]uint32
 	i []string
 }
 
 // NewNaive creates a new, basic implementation of the symboltable function
 func NewNaive(cap int) *Naive {
 	return &Naive{
-		m: make(map[string]int32, cap),
+		m: make(map[string]uint32, cap),
 		i: make([]string, 0, cap),
 	}
 }
 
 // StringToSequence converts a string to a sequence number
-func (n *Naive) StringToSequence(val string, addNew bool) (seq int32, found bool) {
+func (n *Naive) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
 	seq, ok := n.m[val]
 	if ok {
 		return seq, true
 	}
 	if addNew {
-		seq := int32(len(n.m)) + 1
+		if n.m == nil {
+			n.m = make(map[string]uint32)
+		}
+		seq := uint32(len(n.m)) + 1
 		n.i = append(n.i, val)
 		n.m[val] = seq
 		return seq, false
@@ -29,7 +34,55 @@ func (n *Naive) StringToSequence(val string, addNew bool) (seq int32, found bool
 	return 0, false
 }
 
+// BytesToSequence converts a byte slice to a sequence number. val is copied if it is
+// added
+func (n *Naive) BytesToSequence(val []byte, addNew bool) (seq uint32, found bool) {
+	// The compiler avoids allocating for the string conversion in a map lookup
+	seq, ok := n.m[string(val)]
+	if ok || !addNew {
+		return seq, ok
+	}
+	return n.StringToSequence(string(val), true)
+}
+
 // SequenceToString retrieves the string for a sequence number
-func (n *Naive) SequenceToString(seq int32) string {
+func (n *Naive) SequenceToString(seq uint32) string {
 	return n.i[seq-1]
 }
+
+// LookupSequence retrieves the string for a sequence number. ok is false if seq is 0
+// or greater than Len()
+func (n *Naive) LookupSequence(seq uint32) (val string, ok bool) {
+	if seq == 0 || int(seq) > len(n.i) {
+		return "", false
+	}
+	return n.i[seq-1], true
+}
+
+// Len returns the number of unique strings stored
+func (n *Naive) Len() int {
+	return len(n.i)
+}
+
+// All returns an iterator over the sequence numbers and strings, in sequence
+// order
+func (n *Naive) All() iter.Seq2[uint32, string] {
+	return func(yield func(uint32, string) bool) {
+		for j, val := range n.i {
+			if !yield(uint32(j+1), val) {
+				return
+			}
+		}
+	}
+}
+
+// Strings returns an iterator over the strings, in sequence order
+func (n *Naive) Strings() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, val := range n.i {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
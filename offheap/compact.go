@@ -0,0 +1,59 @@
+package offheap
+
+import (
+	"unsafe"
+
+	stringbank "github.com/philpearl/stringbank/offheap"
+)
+
+// CompactReport describes the space reclaimed by Compact
+type CompactReport struct {
+	// Strings is the number of live strings that were copied
+	Strings int
+	// StringBytesBefore and StringBytesAfter are the size of the string
+	// storage, as reported by SymbolSize, before and after compaction
+	StringBytesBefore int
+	StringBytesAfter  int
+	// IntbankBytes is the space released from the sequence number to string
+	// mapping
+	IntbankBytes int
+}
+
+// Reclaimed returns the total number of bytes reclaimed
+func (r CompactReport) Reclaimed() int {
+	return r.StringBytesBefore - r.StringBytesAfter + r.IntbankBytes
+}
+
+// Compact reclaims the space used by deleted strings. Live strings are copied
+// into fresh storage, so Compact takes time proportional to the number of live
+// strings. Sequence numbers of live strings do not change, but strings
+// previously returned by the SymbolTab are not valid after Compact.
+//
+// Storage for ranges of sequence numbers that have all been deleted is also
+// released. Those sequence numbers are never reused, even if RecycleSequences
+// is on. Other deleted sequence numbers are reused lowest first after
+// compaction.
+func (i *SymbolTab) Compact() CompactReport {
+	r := CompactReport{
+		StringBytesBefore: i.sb.Size(),
+	}
+
+	// Live sequence numbers already have space in the intbank, so nothing
+	// here allocates except the stringbank
+	old := i.sb
+	i.sb = stringbank.Stringbank{}
+	for seq := uint32(1); seq <= i.maxSequence; seq++ {
+		if offset := i.ib.lookup(seq); offset >= 0 {
+			i.ib.set(seq, i.sb.Save(old.Get(offset)))
+			r.Strings++
+		}
+	}
+	old.Close()
+	r.StringBytesAfter = i.sb.Size()
+
+	var released int
+	i.freeList, released = i.ib.releaseDeleted(i.maxSequence)
+	r.IntbankBytes = released * intbanksize * int(unsafe.Sizeof(int(0)))
+
+	return r
+}
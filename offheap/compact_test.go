@@ -0,0 +1,111 @@
+package offheap
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	const n = 100_000
+	for i := range n {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	// Delete the first half, which should release whole intbank slabs, then
+	// every other string of the rest
+	for i := range n {
+		if i < n/2 || i%2 == 0 {
+			require.True(t, st.Delete(strconv.Itoa(i)))
+		}
+	}
+	before := st.SymbolSize()
+
+	r := st.Compact()
+	assert.Equal(t, n/4, r.Strings)
+	assert.Equal(t, before, r.StringBytesBefore)
+	assert.Equal(t, st.SymbolSize(), r.StringBytesAfter)
+	assert.True(t, r.StringBytesAfter < r.StringBytesBefore/2, r)
+	assert.NotZero(t, r.IntbankBytes)
+	assert.Equal(t, r.StringBytesBefore-r.StringBytesAfter+r.IntbankBytes, r.Reclaimed())
+
+	// Surviving strings keep their sequence numbers
+	assert.Equal(t, n/4, st.Len())
+	for i := range n {
+		val := strconv.Itoa(i)
+		seq, found := st.StringToSequence(val, false)
+		if i < n/2 || i%2 == 0 {
+			assert.False(t, found)
+			_, ok := st.LookupSequence(uint32(i + 1))
+			assert.False(t, ok)
+			continue
+		}
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, val, st.SequenceToString(seq))
+	}
+
+	// Compacting again has nothing to do
+	r = st.Compact()
+	assert.Equal(t, n/4, r.Strings)
+	assert.Zero(t, r.Reclaimed())
+
+	// We can still add and delete
+	seq, found := st.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(n+1), seq)
+	assert.True(t, st.Delete("hat"))
+	assert.True(t, st.Delete(strconv.Itoa(n-1)))
+
+	// The file includes the released sequence numbers as deleted
+	path := filepath.Join(t.TempDir(), "symbols")
+	require.NoError(t, st.WriteFile(path))
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.Equal(t, st.Len(), m.Len())
+	for seq, val := range st.All() {
+		assert.Equal(t, val, m.SequenceToString(seq))
+	}
+}
+
+func TestCompactRecycle(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	st.RecycleSequences(true)
+	for i := range 2 * intbanksize {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	// Delete all of the first slab, and a few from the second
+	for i := range intbanksize + 3 {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	st.Compact()
+
+	// The sequence numbers from the first slab are gone for good. The others
+	// are reused lowest first.
+	for i := range 3 {
+		seq, found := st.StringToSequence("new"+strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(intbanksize+i+1), seq)
+	}
+	seq, _ := st.StringToSequence("another", true)
+	assert.Equal(t, uint32(2*intbanksize+1), seq)
+
+	for seq, val := range st.All() {
+		seq2, found := st.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, seq, seq2)
+	}
+}
+
+func TestCompactEmpty(t *testing.T) {
+	var st SymbolTab
+	defer st.Close()
+	r := st.Compact()
+	assert.Zero(t, r)
+}
@@ -0,0 +1,341 @@
+package offheap
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/philpearl/mmap"
+)
+
+// ConcurrentSymbolTab is a symbol table that is safe for concurrent use.
+// SequenceToString, and StringToSequence with addNew false, take no locks.
+// Adding new strings is serialised by a mutex.
+//
+// Readers and the writer share the hash table. Entries are read and written
+// atomically, and entries are only ever added, so a reader either sees a
+// complete entry or none at all. While the table is growing readers look in
+// both the old and new tables, just as SymbolTab does. The old table is never
+// changed once a resize starts, so anything a reader can't find in it has been
+// added since the resize began.
+//
+// Because readers may still be using an old table after a resize completes,
+// old tables are only released when the ConcurrentSymbolTab is closed.
+type ConcurrentSymbolTab struct {
+	mu             sync.Mutex
+	tables         atomic.Pointer[concurrentTables]
+	count          atomic.Uint32
+	oldTableCursor int
+	retired        [][]atomic.Uint64
+	sb             concurrentStringbank
+	ib             concurrentIntbank
+}
+
+// concurrentTables holds the current and old tables. We replace the whole
+// struct when either changes so that readers see a consistent pair. The hash
+// seed is kept alongside, so readers of the zero value see it set along with
+// the first table.
+type concurrentTables struct {
+	table    []atomic.Uint64
+	oldTable []atomic.Uint64
+	seed     uintptr
+}
+
+// NewConcurrent creates a new ConcurrentSymbolTab. cap is the initial capacity
+// of the table - it will grow automatically when needed
+func NewConcurrent(cap int) *ConcurrentSymbolTab {
+	cap = cap * loadFactor
+	if cap < 16 {
+		cap = 16
+	} else {
+		cap = 1 << uint(64-bits.LeadingZeros(uint(cap-1)))
+	}
+	var i ConcurrentSymbolTab
+	i.tables.Store(&concurrentTables{table: allocTable(cap), seed: newSeed()})
+	return &i
+}
+
+// Close releases resources associated with the ConcurrentSymbolTab. It must not
+// be called while the table is in use.
+func (i *ConcurrentSymbolTab) Close() {
+	if tables := i.tables.Load(); tables != nil {
+		mmap.Free(tables.table)
+		if tables.oldTable != nil {
+			mmap.Free(tables.oldTable)
+		}
+	}
+	for _, t := range i.retired {
+		mmap.Free(t)
+	}
+	i.retired = nil
+	i.tables.Store(nil)
+	i.count.Store(0)
+	i.oldTableCursor = 0
+	i.sb.close()
+	i.ib.close()
+}
+
+// Len returns the number of unique strings stored
+func (i *ConcurrentSymbolTab) Len() int {
+	return int(i.count.Load())
+}
+
+// SequenceToString looks up a string by its sequence number. Obtain the
+// sequence number for a string with StringToSequence
+func (i *ConcurrentSymbolTab) SequenceToString(seq uint32) string {
+	return i.sb.get(i.ib.lookup(seq))
+}
+
+// StringToSequence looks up the string val and returns its sequence number seq. If val does
+// not currently exist in the symbol table, it will add it if addNew is true. found indicates
+// whether val was already present in the ConcurrentSymbolTab
+func (i *ConcurrentSymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
+	// Most of the time we expect the string to be present, so look without the lock first
+	if seq := i.find(i.tables.Load(), val); seq != 0 {
+		return seq, true
+	}
+	if !addNew {
+		return 0, false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.resize()
+	i.resizeWork()
+
+	// Someone may have added the string since we looked
+	tables := i.tables.Load()
+	hash := stringHash(val, tables.seed)
+	if tables.oldTable != nil {
+		if _, seq := i.findInTable(tables.oldTable, val, hash); seq != 0 {
+			return seq, true
+		}
+	}
+	cursor, seq := i.findInTable(tables.table, val, hash)
+	if seq != 0 {
+		return seq, true
+	}
+
+	// We save the string before publishing the table entry, so any reader that
+	// finds the entry can find the string
+	seq = i.count.Load() + 1
+	i.ib.save(seq, i.sb.save(val))
+	tables.table[cursor].Store(packEntry(hash, seq))
+	i.count.Store(seq)
+
+	return seq, false
+}
+
+func (i *ConcurrentSymbolTab) find(tables *concurrentTables, val string) (seq uint32) {
+	if tables == nil {
+		return 0
+	}
+	hash := stringHash(val, tables.seed)
+	if tables.oldTable != nil {
+		if _, seq := i.findInTable(tables.oldTable, val, hash); seq != 0 {
+			return seq
+		}
+	}
+	_, seq = i.findInTable(tables.table, val, hash)
+	return seq
+}
+
+func (i *ConcurrentSymbolTab) findInTable(table []atomic.Uint64, val string, hashVal uint32) (cursor int, sequence uint32) {
+	l := len(table)
+	cursor = int(hashVal) & (l - 1)
+	start := cursor
+	for {
+		hash, seq := unpackEntry(table[cursor].Load())
+		if seq == 0 {
+			return cursor, 0
+		}
+		if hash == hashVal && i.SequenceToString(seq) == val {
+			return cursor, seq
+		}
+		cursor = (cursor + 1) & (l - 1)
+		if cursor == start {
+			panic("out of space!")
+		}
+	}
+}
+
+func (i *ConcurrentSymbolTab) copyEntryToTable(table []atomic.Uint64, entry uint64) {
+	l := len(table)
+	hash, _ := unpackEntry(entry)
+	cursor := int(hash) & (l - 1)
+	start := cursor
+	for table[cursor].Load() != 0 {
+		cursor = (cursor + 1) & (l - 1)
+		if cursor == start {
+			panic("out of space (resize)!")
+		}
+	}
+	table[cursor].Store(entry)
+}
+
+// resizeWork copies 16 entries from the old table to the new. It must be called
+// with the lock held.
+func (i *ConcurrentSymbolTab) resizeWork() {
+	tables := i.tables.Load()
+	if tables.oldTable == nil {
+		return
+	}
+	for k := range tables.oldTable[i.oldTableCursor : i.oldTableCursor+16] {
+		if entry := tables.oldTable[i.oldTableCursor+k].Load(); entry != 0 {
+			i.copyEntryToTable(tables.table, entry)
+		}
+	}
+	i.oldTableCursor += 16
+	if i.oldTableCursor >= len(tables.oldTable) {
+		// resizing is complete. Readers that still have the old table can
+		// carry on using it, so we can't free it yet.
+		i.tables.Store(&concurrentTables{table: tables.table, seed: tables.seed})
+		i.retired = append(i.retired, tables.oldTable)
+		i.oldTableCursor = 0
+	}
+}
+
+// resize starts a resize if the table is full enough. It must be called with
+// the lock held.
+func (i *ConcurrentSymbolTab) resize() {
+	tables := i.tables.Load()
+	if tables == nil {
+		// Makes zero value of ConcurrentSymbolTab useful
+		tables = &concurrentTables{table: allocTable(16), seed: newSeed()}
+		i.tables.Store(tables)
+	}
+
+	if int(i.count.Load()) < len(tables.table)/loadFactor || tables.oldTable != nil {
+		return
+	}
+
+	if len(tables.table) >= math.MaxUint32 {
+		// We can't grow the table any more. We can let the table get fuller
+		if i.count.Load() >= math.MaxUint32*3/4 {
+			panic("out of space in symboltab!")
+		}
+		return
+	}
+
+	i.tables.Store(&concurrentTables{
+		table:    allocTable(len(tables.table) * 2),
+		oldTable: tables.table,
+		seed:     tables.seed,
+	})
+}
+
+func allocTable(cap int) []atomic.Uint64 {
+	t, _ := mmap.Alloc[atomic.Uint64](cap)
+	return t
+}
+
+// packEntry packs a hash and sequence number into a single word so that they
+// can be written atomically. A zero entry is empty, as sequence numbers start
+// at 1.
+func packEntry(hash, seq uint32) uint64 {
+	return uint64(seq)<<32 | uint64(hash)
+}
+
+func unpackEntry(entry uint64) (hash, seq uint32) {
+	return uint32(entry), uint32(entry >> 32)
+}
+
+const concurrentStringbankSize = 1 << 18
+
+// concurrentStringbank stores strings so that they can be read while new strings
+// are being added. Only one goroutine may save strings at a time. The list of
+// pages is copied when it grows, and the bytes of each string are written
+// before it is published to readers.
+type concurrentStringbank struct {
+	pages   atomic.Pointer[[][]byte]
+	current []byte
+}
+
+func (s *concurrentStringbank) close() {
+	if p := s.pages.Load(); p != nil {
+		for _, page := range *p {
+			mmap.Free(page)
+		}
+	}
+	s.pages.Store(nil)
+	s.current = nil
+}
+
+// save stores val and returns an offset. The page number is in the top 32 bits,
+// and the offset within the page in the bottom.
+func (s *concurrentStringbank) save(val string) uint64 {
+	var lenBuf [binary.MaxVarintLen64]byte
+	lenLen := binary.PutUvarint(lenBuf[:], uint64(len(val)))
+	l := lenLen + len(val)
+
+	var pages [][]byte
+	if p := s.pages.Load(); p != nil {
+		pages = *p
+	}
+	if len(s.current)+l > cap(s.current) {
+		// Big strings get a page of their own
+		page, _ := mmap.Alloc[byte](max(concurrentStringbankSize, l))
+		s.current = page[:0]
+		pages = append(pages[:len(pages):len(pages)], page)
+		s.pages.Store(&pages)
+	}
+
+	offset := len(s.current)
+	s.current = s.current[:offset+l]
+	copy(s.current[offset:], lenBuf[:lenLen])
+	copy(s.current[offset+lenLen:], val)
+
+	return uint64(len(pages)-1)<<32 | uint64(offset)
+}
+
+func (s *concurrentStringbank) get(offset uint64) string {
+	data := (*s.pages.Load())[offset>>32][uint32(offset):]
+	l, lenLen := binary.Uvarint(data)
+	b := data[lenLen : lenLen+int(l)]
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// concurrentIntbank maps sequence numbers to stringbank offsets. Like
+// concurrentStringbank it may be read while one goroutine writes.
+type concurrentIntbank struct {
+	slabs atomic.Pointer[[][]uint64]
+}
+
+func (ib *concurrentIntbank) close() {
+	if s := ib.slabs.Load(); s != nil {
+		for _, slab := range *s {
+			mmap.Free(slab)
+		}
+	}
+	ib.slabs.Store(nil)
+}
+
+func (ib *concurrentIntbank) save(sequence uint32, offset uint64) {
+	sequence-- // externally sequence starts at 1
+	slabNo := int(sequence / intbanksize)
+	slabOffset := int(sequence % intbanksize)
+
+	var slabs [][]uint64
+	if s := ib.slabs.Load(); s != nil {
+		slabs = *s
+	}
+	if len(slabs) <= slabNo {
+		ns, _ := mmap.Alloc[uint64](intbanksize)
+		slabs = append(slabs[:len(slabs):len(slabs)], ns)
+		ib.slabs.Store(&slabs)
+	}
+
+	slabs[slabNo][slabOffset] = offset
+}
+
+func (ib *concurrentIntbank) lookup(sequence uint32) uint64 {
+	sequence-- // externally, sequence starts at 1
+	slabNo := int(sequence / intbanksize)
+	slabOffset := int(sequence % intbanksize)
+
+	return (*ib.slabs.Load())[slabNo][slabOffset]
+}
@@ -0,0 +1,158 @@
+package offheap
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentBasic(t *testing.T) {
+	var st ConcurrentSymbolTab
+	defer st.Close()
+
+	seq, found := st.StringToSequence("hat", false)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+
+	seq, found = st.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	seq, found = st.StringToSequence("hat", false)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	assert.Equal(t, "hat", st.SequenceToString(1))
+	assert.Equal(t, 1, st.Len())
+
+	// Strings bigger than a stringbank page are stored separately
+	big := strings.Repeat("x", concurrentStringbankSize+1)
+	seq, found = st.StringToSequence(big, true)
+	assert.False(t, found)
+	assert.Equal(t, big, st.SequenceToString(seq))
+	assert.Equal(t, "hat", st.SequenceToString(1))
+}
+
+func TestConcurrentGrowth(t *testing.T) {
+	st := NewConcurrent(16)
+	defer st.Close()
+
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(uint32(i+1)))
+	}
+}
+
+// TestConcurrentReadWrite is intended to be run with the race detector. Readers
+// look up strings while writers add more, forcing the table through many
+// resizes.
+func TestConcurrentReadWrite(t *testing.T) {
+	const (
+		writers   = 4
+		readers   = 4
+		perWriter = 20_000
+	)
+	st := NewConcurrent(0)
+	defer st.Close()
+
+	// Some strings are present before we start. Readers should always find these
+	const initial = 1000
+	for i := range initial {
+		st.StringToSequence("initial"+strconv.Itoa(i), true)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for i := range initial {
+					val := "initial" + strconv.Itoa(i)
+					seq, found := st.StringToSequence(val, false)
+					if !found || seq != uint32(i+1) {
+						t.Errorf("lookup of %s returned %d, %t", val, seq, found)
+						return
+					}
+					if str := st.SequenceToString(seq); str != val {
+						t.Errorf("sequence %d returned %s, expected %s", seq, str, val)
+						return
+					}
+				}
+				// Strings added by writers may or may not be there, but if
+				// they are they should be correct
+				for i := range perWriter {
+					val := strconv.Itoa(i)
+					if seq, found := st.StringToSequence(val, false); found {
+						if str := st.SequenceToString(seq); str != val {
+							t.Errorf("sequence %d returned %s, expected %s", seq, str, val)
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	// The writers all add the same strings so they race to add them
+	var writerWg sync.WaitGroup
+	results := make([][]uint32, writers)
+	for w := range writers {
+		writerWg.Add(1)
+		go func() {
+			defer writerWg.Done()
+			results[w] = make([]uint32, perWriter)
+			for i := range perWriter {
+				results[w][i], _ = st.StringToSequence(strconv.Itoa(i), true)
+			}
+		}()
+	}
+	writerWg.Wait()
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, initial+perWriter, st.Len())
+	for w := 1; w < writers; w++ {
+		assert.Equal(t, results[0], results[w])
+	}
+	for i, seq := range results[0] {
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(seq))
+	}
+}
+
+func BenchmarkConcurrentExisting(b *testing.B) {
+	st := NewConcurrent(100_000)
+	defer st.Close()
+	values := make([]string, 100_000)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+		st.StringToSequence(values[i], true)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			st.StringToSequence(values[i%len(values)], false)
+			i++
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package offheap
+
+// Delete removes val from the SymbolTab. It returns false if val was not present.
+//
+// The sequence number for val is not reused unless RecycleSequences has been turned
+// on. The space used by the string is not reclaimed until Compact is called.
+// Unlike symboltab.SymbolTab, Delete never compacts the SymbolTab itself, as
+// that would make strings it has already returned invalid. Under steady churn
+// call Compact periodically, when nothing holds on to strings from the
+// SymbolTab, to keep memory bounded.
+func (i *SymbolTab) Delete(val string) bool {
+	hash := i.hash.sum32(val, i.seed)
+
+	// During a resize the entry may be in the old table, the new table or both. We
+	// need to remove it from wherever it is.
+	var seq uint32
+	if i.oldTable.len() != 0 {
+		if cursor, sequence := i.findInTable(i.oldTable, val, hash); sequence != 0 {
+			i.oldTable.remove(cursor)
+			seq = sequence
+		}
+	}
+	if cursor, sequence := i.findInTable(i.table, val, hash); sequence != 0 {
+		if i.table.remove(cursor) {
+			i.tombstones++
+		}
+		seq = sequence
+	}
+	if seq == 0 {
+		return false
+	}
+
+	i.ib.delete(seq, i.freeList)
+	i.freeList = seq
+	i.count--
+	i.indexDelete(seq)
+	return true
+}
+
+// DeleteSequence removes the string with sequence number seq from the SymbolTab. It
+// returns false if seq is not present.
+func (i *SymbolTab) DeleteSequence(seq uint32) bool {
+	val, ok := i.LookupSequence(seq)
+	if !ok {
+		return false
+	}
+	return i.Delete(val)
+}
+
+// RecycleSequences controls whether sequence numbers freed by Delete and
+// DeleteSequence are reused for new strings. It is off by default, so sequence
+// numbers are never reused. If it is on, the most recently freed sequence number
+// is used first.
+func (i *SymbolTab) RecycleSequences(recycle bool) {
+	i.recycle = recycle
+}
@@ -0,0 +1,175 @@
+package offheap
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelete(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for _, val := range []string{"a", "b", "c"} {
+		st.StringToSequence(val, true)
+	}
+
+	assert.True(t, st.Delete("b"))
+	assert.False(t, st.Delete("b"))
+	assert.False(t, st.Delete("d"))
+	assert.Equal(t, 2, st.Len())
+
+	_, found := st.StringToSequence("b", false)
+	assert.False(t, found)
+	_, ok := st.LookupSequence(2)
+	assert.False(t, ok)
+
+	seq, found := st.StringToSequence("c", false)
+	assert.True(t, found)
+	assert.Equal(t, uint32(3), seq)
+
+	assert.True(t, st.DeleteSequence(1))
+	assert.False(t, st.DeleteSequence(1))
+	assert.False(t, st.DeleteSequence(0))
+	assert.False(t, st.DeleteSequence(37))
+	assert.Equal(t, 1, st.Len())
+
+	// Sequence numbers are not reused by default
+	seq, found = st.StringToSequence("b", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(4), seq)
+
+	var seqs []uint32
+	for seq := range st.All() {
+		seqs = append(seqs, seq)
+	}
+	assert.Equal(t, []uint32{3, 4}, seqs)
+}
+
+func TestDeleteRecycle(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	st.RecycleSequences(true)
+	for _, val := range []string{"a", "b", "c", "d"} {
+		st.StringToSequence(val, true)
+	}
+	assert.True(t, st.Delete("b"))
+	assert.True(t, st.Delete("c"))
+
+	// Most recently freed sequence numbers are used first
+	seq, found := st.StringToSequence("e", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(3), seq)
+	seq, found = st.StringToSequence("f", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(2), seq)
+	seq, found = st.StringToSequence("g", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(5), seq)
+
+	for seq, val := range map[uint32]string{1: "a", 2: "f", 3: "e", 4: "d", 5: "g"} {
+		assert.Equal(t, val, st.SequenceToString(seq))
+		seq2, found := st.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, seq, seq2)
+	}
+}
+
+func TestDeleteDuringResize(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 8_500 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+
+	// Delete entries that have and have not been copied to the new table yet
+	for i := 0; i < 8_500; i += 2 {
+		assert.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	for i := 8_500; i < 10_000; i++ {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Zero(t, st.oldTable.len())
+
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		if i < 8_500 && i%2 == 0 {
+			assert.False(t, found, i)
+		} else {
+			assert.True(t, found, i)
+			assert.Equal(t, uint32(i+1), seq)
+		}
+	}
+}
+
+func TestDeleteChurn(t *testing.T) {
+	for _, recycle := range []bool{false, true} {
+		t.Run(strconv.FormatBool(recycle), func(t *testing.T) {
+			st := New(16)
+			defer st.Close()
+			st.RecycleSequences(recycle)
+
+			// Keep 1000 strings in the table, adding new ones and deleting the
+			// oldest
+			const live = 1000
+			var maxCap int
+			for i := range 100_000 {
+				st.StringToSequence(strconv.Itoa(i), true)
+				if i >= live {
+					require.True(t, st.Delete(strconv.Itoa(i-live)))
+				}
+				if i > 10*live {
+					// The table should stop growing once we've been through a
+					// few cycles
+					maxCap = max(maxCap, st.Cap())
+				}
+			}
+			assert.Equal(t, live, st.Len())
+			assert.True(t, maxCap <= 4*live*loadFactor, maxCap)
+			if recycle {
+				assert.True(t, int(st.maxSequence) <= live+1, st.maxSequence)
+				assert.True(t, len(st.ib.slabs) <= live/intbanksize+1, len(st.ib.slabs))
+			}
+
+			for i := 100_000 - live; i < 100_000; i++ {
+				_, found := st.StringToSequence(strconv.Itoa(i), false)
+				assert.True(t, found)
+			}
+		})
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 100 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	for i := 0; i < 100; i += 3 {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+
+	path := filepath.Join(t.TempDir(), "symbols")
+	require.NoError(t, st.WriteFile(path))
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, m.Verify())
+
+	assert.Equal(t, st.Len(), m.Len())
+	for i := range 100 {
+		seq, found := m.StringToSequence(strconv.Itoa(i))
+		if i%3 == 0 {
+			assert.False(t, found)
+			assert.Equal(t, "", m.SequenceToString(uint32(i+1)))
+			continue
+		}
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), m.SequenceToString(seq))
+	}
+}
@@ -0,0 +1,938 @@
+package offheap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// A symbol table file holds a table, intbank and strings laid out so that the
+// file can be mapped straight into memory and used without any loading step.
+// FileSymbolTab runs on a file, adding strings to it in place. OpenFile maps a
+// file read-only, as a MappedSymbolTab, and any number of processes can do so
+// at once, including while a FileSymbolTab has the file open for writing.
+// WriteFile copies a SymbolTab into a new file.
+//
+// The file starts with a 4 KiB page holding two 128-byte header slots. The
+// rest of the file is a heap of extents, each allocated at the end of the
+// file. Extents are never moved or reused once they are part of a synced
+// header, so a reader using an older header is not disturbed by a writer
+// adding strings. When the table or slab directory grows the new copy is
+// allocated at the end of the file and the old one is left where it is, which
+// wastes up to as much space again as the current table.
+//
+// All integers are little-endian. A header slot is as follows.
+//
+//	magic      [8]byte "SYMTABMF"
+//	version    uint32
+//	hash       uint32 identifies the hash function used for the table
+//	generation uint64 incremented each time a header is written
+//	count      uint64 number of sequence numbers, including deleted ones
+//	deleted    uint64 number of deleted sequence numbers
+//	end        uint64 end of the allocated part of the file
+//	table      uint64 offset of the table, (hash uint32, sequence uint32) * table len
+//	table len  uint64
+//	slabs      uint64 offset of the slab directory, uint64 * slab cap
+//	slab cap   uint64
+//	str pos    uint64 next free byte in the current string chunk
+//	str end    uint64 end of the current string chunk
+//	flags      uint32 1 if the file was closed cleanly
+//	reserved   [24]byte
+//	header crc uint32 CRC-32C of the preceding 124 bytes
+//
+// Entry n of the slab directory is the offset of the slab for sequence numbers
+// n*4096+1 to (n+1)*4096. A slab holds the offset of each string, or 0 if the
+// sequence number is deleted. Each string is a uint32 length followed by the
+// bytes of the string. Small strings are packed into 64 KiB chunks.
+//
+// Sync first syncs the data, then writes the header to the slot not used by
+// the current header, and syncs again. Readers take whichever valid header has
+// the higher generation, so if a header write is torn the previous header is
+// used. After a crash the file holds the strings as of the last Sync or Close.
+// Table entries and slab slots beyond the count in the header may have been
+// written before the crash, so readers ignore them, and the next FileSymbolTab
+// to open the file clears them.
+//
+// The runtime hash used by SymbolTab is randomised per process, so the table
+// in the file is built with a stable hash instead. Deleted sequence numbers
+// have no entry in the table.
+const (
+	fileMagic      = "SYMTABMF"
+	fileVersion    = 2
+	fileHeaderSize = 128
+	fileDataStart  = 4096
+
+	fileHashFNV1a = 1
+
+	fileFlagClosed = 1
+
+	fileSlabLen     = 1 << 12
+	fileChunkLen    = 1 << 16
+	fileMinTableLen = 16
+	fileMaxTableLen = 1 << 32
+	// fileMaxSize is the largest file we support. FileSymbolTab reserves this
+	// much address space up front so that the mapping never moves.
+	fileMaxSize = min(1<<40, math.MaxInt/2+1)
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrInvalidFormat is returned by OpenFile if the file is not a symbol
+	// table file, or is a version we don't understand
+	ErrInvalidFormat = errors.New("symboltab: invalid file format")
+	// ErrChecksum is returned if the file is corrupt
+	ErrChecksum = errors.New("symboltab: checksum mismatch")
+	// ErrLocked is returned by OpenWritable if another FileSymbolTab has the
+	// file open
+	ErrLocked = errors.New("symboltab: file is open for writing elsewhere")
+)
+
+// WriteFile writes the SymbolTab to a file that can be opened with OpenFile or
+// OpenWritable. Deleted sequence numbers stay deleted in the file.
+//
+// The data is written to a temporary file in the same directory, synced, and
+// then renamed over path. So if we crash part way through, path either holds
+// the previous file or the complete new one.
+func (i *SymbolTab) WriteFile(path string) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(name)
+		}
+	}()
+
+	ft, err := openWritable(name, i.count)
+	if err != nil {
+		return err
+	}
+	for seq := uint32(1); seq <= i.maxSequence; seq++ {
+		if val, ok := i.LookupSequence(seq); ok {
+			_, _, err = ft.Insert(val)
+		} else {
+			err = ft.insertDeleted()
+		}
+		if err != nil {
+			ft.Close()
+			return err
+		}
+	}
+	if err := ft.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name, path); err != nil {
+		return err
+	}
+
+	// Make sure the rename is durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// FileSymbolTab is a symbol table that runs on a memory-mapped file. Strings
+// added to it are written straight into the file, so the table can be reopened
+// by another process with no load step. Open one with OpenWritable.
+//
+// Only one FileSymbolTab can have a file open at a time, but any number of
+// processes can open the same file read-only with OpenFile. Readers see the
+// strings as of the last Sync or Close before they opened the file.
+//
+// Strings can't be deleted from a FileSymbolTab, as that would change data a
+// reader may be using. A FileSymbolTab is not safe for concurrent use.
+type FileSymbolTab struct {
+	f *os.File
+	// data is a mapping of fileMaxSize bytes, so it never has to move as the
+	// file grows. Only the first size bytes are backed by the file.
+	data []byte
+	size uint64
+	view fileView
+}
+
+// OpenWritable opens the symbol table file at path for reading and writing,
+// creating it if it does not exist. If another FileSymbolTab has the file open
+// it returns ErrLocked.
+//
+// If the file was not closed cleanly, any strings added after the last Sync
+// are discarded.
+func OpenWritable(path string) (*FileSymbolTab, error) {
+	return openWritable(path, 0)
+}
+
+// openWritable opens the file at path. If it creates a new file it sizes the
+// table for capacity strings.
+func openWritable(path string, capacity int) (_ *FileSymbolTab, err error) {
+	if !littleEndian() {
+		return nil, fmt.Errorf("%w: only supported on little-endian systems", ErrInvalidFormat)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, fileMaxSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			syscall.Munmap(data)
+		}
+	}()
+
+	ft := &FileSymbolTab{
+		f:    f,
+		data: data,
+		size: uint64(fi.Size()),
+	}
+	if ft.size == 0 {
+		err = ft.init(capacity)
+	} else {
+		err = ft.load()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Record that the file is open before we change anything, so that if we
+	// crash the next FileSymbolTab knows to clean up after us
+	if err := ft.writeHeader(false); err != nil {
+		return nil, err
+	}
+	return ft, nil
+}
+
+// init lays out a new, empty file
+func (ft *FileSymbolTab) init(capacity int) error {
+	ft.view = fileView{data: ft.data}
+	h := &ft.view.h
+	h.end = fileDataStart
+
+	l := uint64(fileMinTableLen)
+	for uint64(capacity) >= l/loadFactor && l < fileMaxTableLen {
+		l *= 2
+	}
+	table, err := ft.alloc(l * 8)
+	if err != nil {
+		return err
+	}
+	h.table, h.tableLen = table, l
+	ft.view.setTable()
+
+	slabs, err := ft.alloc(16 * 8)
+	if err != nil {
+		return err
+	}
+	h.slabs, h.slabsCap = slabs, 16
+	return nil
+}
+
+// load reads the header of an existing file
+func (ft *FileSymbolTab) load() error {
+	h, err := readFileHeader(ft.data, ft.size)
+	if err != nil {
+		return err
+	}
+	ft.view = fileView{data: ft.data, h: h}
+	ft.view.setTable()
+
+	if h.flags&fileFlagClosed == 0 {
+		// The last writer crashed. It may have added entries to the table
+		// after its last Sync. Those strings are lost, so clear the entries.
+		// As strings are never removed from the table, clearing the newest
+		// entries leaves the table exactly as it was at the Sync.
+		for i, e := range ft.view.entries {
+			if uint64(e.sequence) > h.count {
+				ft.view.entries[i] = tableEntry{}
+			}
+		}
+	}
+	return nil
+}
+
+// Sync makes the strings added so far durable. If we crash, the file will
+// hold the strings as they were at the last Sync or Close.
+func (ft *FileSymbolTab) Sync() error {
+	return ft.writeHeader(false)
+}
+
+// Close syncs and closes the file. Strings returned from the FileSymbolTab are
+// not valid after Close is called.
+func (ft *FileSymbolTab) Close() error {
+	if ft.f == nil {
+		return nil
+	}
+
+	// If the current string chunk is at the end of the file, give back the
+	// part we haven't used
+	h := &ft.view.h
+	if h.strEnd == h.end {
+		h.end = (h.strPos + 7) &^ 7
+		h.strPos, h.strEnd = h.end, h.end
+	}
+
+	err := ft.writeHeader(true)
+	if e := syscall.Munmap(ft.data); err == nil {
+		err = e
+	}
+	if err == nil {
+		// Nothing beyond end is in use, so the file can be trimmed. Readers
+		// only touch the parts of the file their header refers to, and
+		// those are all before end.
+		err = ft.f.Truncate(int64(h.end))
+	}
+	if e := ft.f.Close(); err == nil {
+		err = e
+	}
+	*ft = FileSymbolTab{}
+	return err
+}
+
+// writeHeader syncs the data, then writes the header into the slot the current
+// header is not using, and syncs again.
+func (ft *FileSymbolTab) writeHeader(closed bool) error {
+	if err := ft.f.Sync(); err != nil {
+		return err
+	}
+
+	h := ft.view.h
+	h.generation++
+	h.flags &^= fileFlagClosed
+	if closed {
+		h.flags |= fileFlagClosed
+	}
+	h.marshal(ft.data[h.generation%2*fileHeaderSize:][:fileHeaderSize])
+	if err := ft.f.Sync(); err != nil {
+		return err
+	}
+	ft.view.h.generation = h.generation
+	return nil
+}
+
+// Len returns the number of unique strings stored
+func (ft *FileSymbolTab) Len() int {
+	return ft.view.len()
+}
+
+// StringToSequence looks up the string val and returns its sequence number seq. If val does
+// not currently exist in the symbol table, it will add it if addNew is true. found indicates
+// whether val was already present in the FileSymbolTab
+//
+// If val can't be added, StringToSequence returns 0. Use Insert to find out
+// why.
+func (ft *FileSymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
+	if !addNew {
+		_, seq = ft.view.find(val, fnv1a(val))
+		return seq, seq != 0
+	}
+	seq, found, _ = ft.Insert(val)
+	return seq, found
+}
+
+// BytesToSequence is like StringToSequence, but takes a byte slice. It does not
+// allocate, and val is only copied if it is added to the table.
+func (ft *FileSymbolTab) BytesToSequence(val []byte, addNew bool) (seq uint32, found bool) {
+	return ft.StringToSequence(unsafe.String(unsafe.SliceData(val), len(val)), addNew)
+}
+
+// Insert looks up the string val and returns its sequence number seq, adding
+// val if it is not already present. found indicates whether val was already
+// present.
+//
+// Unlike StringToSequence, Insert returns an error if val can't be added. The
+// error is ErrFull if the file is out of space or sequence numbers, or the
+// error from writing the file. The FileSymbolTab is unchanged and can still
+// be used.
+func (ft *FileSymbolTab) Insert(val string) (seq uint32, found bool, err error) {
+	hash := fnv1a(val)
+	cursor, seq := ft.view.find(val, hash)
+	if seq != 0 {
+		return seq, true, nil
+	}
+
+	h := &ft.view.h
+	if h.count >= math.MaxUint32-1 {
+		return 0, false, ErrFull
+	}
+	if uint64(len(val)) > math.MaxUint32 {
+		return 0, false, fmt.Errorf("%w: string of %d bytes is too long", ErrFull, len(val))
+	}
+	if cursor < 0 || h.count-h.deleted >= h.tableLen/loadFactor {
+		if err := ft.growTable(); err != nil {
+			return 0, false, err
+		}
+		cursor, _ = ft.view.find(val, hash)
+	}
+
+	seq = uint32(h.count + 1)
+	slot, err := ft.slotFor(seq)
+	if err != nil {
+		return 0, false, err
+	}
+	offset, err := ft.saveString(val)
+	if err != nil {
+		return 0, false, err
+	}
+	*slot = offset
+	ft.view.entries[cursor] = tableEntry{hash: hash, sequence: seq}
+	h.count++
+	return seq, false, nil
+}
+
+// insertDeleted uses up a sequence number without adding a string, so that
+// WriteFile can keep the sequence numbers of a SymbolTab with deleted strings.
+func (ft *FileSymbolTab) insertDeleted() error {
+	h := &ft.view.h
+	if h.count >= math.MaxUint32-1 {
+		return ErrFull
+	}
+	slot, err := ft.slotFor(uint32(h.count + 1))
+	if err != nil {
+		return err
+	}
+	*slot = 0
+	h.count++
+	h.deleted++
+	return nil
+}
+
+// SequenceToString looks up a string by its sequence number. The string refers
+// directly to the mapped file, so is only valid until Close is called. It
+// returns an empty string if seq is not valid.
+func (ft *FileSymbolTab) SequenceToString(seq uint32) string {
+	val, _ := ft.view.lookup(seq)
+	return val
+}
+
+// LookupSequence looks up a string by its sequence number. If seq is 0, has not
+// been allocated, or has been deleted, ok is false.
+func (ft *FileSymbolTab) LookupSequence(seq uint32) (val string, ok bool) {
+	return ft.view.lookup(seq)
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// FileSymbolTab, in sequence order. Deleted sequence numbers are skipped.
+func (ft *FileSymbolTab) All() iter.Seq2[uint32, string] {
+	return ft.view.all()
+}
+
+// Strings returns an iterator over the strings in the FileSymbolTab, in
+// sequence order.
+func (ft *FileSymbolTab) Strings() iter.Seq[string] {
+	return ft.view.strings()
+}
+
+// growTable moves the table to a new extent twice the size
+func (ft *FileSymbolTab) growTable() error {
+	h := &ft.view.h
+	if h.tableLen >= fileMaxTableLen {
+		return ErrFull
+	}
+	table, err := ft.alloc(h.tableLen * 2 * 8)
+	if err != nil {
+		return err
+	}
+	old := ft.view.entries
+	h.table, h.tableLen = table, h.tableLen*2
+	ft.view.setTable()
+	for _, e := range old {
+		if e.sequence != 0 {
+			ft.view.place(e)
+		}
+	}
+	return nil
+}
+
+// slotFor returns where the string offset for seq is recorded. If seq is the
+// first sequence number in its slab it allocates the slab.
+func (ft *FileSymbolTab) slotFor(seq uint32) (*uint64, error) {
+	h := &ft.view.h
+	if i := uint64(seq - 1); i%fileSlabLen == 0 {
+		k := i / fileSlabLen
+		if k >= h.slabsCap {
+			slabs, err := ft.alloc(h.slabsCap * 2 * 8)
+			if err != nil {
+				return nil, err
+			}
+			copy(ft.data[slabs:], ft.data[h.slabs:h.slabs+h.slabsCap*8])
+			h.slabs, h.slabsCap = slabs, h.slabsCap*2
+		}
+		slab, err := ft.alloc(fileSlabLen * 8)
+		if err != nil {
+			return nil, err
+		}
+		*ft.view.uint64At(h.slabs + k*8) = slab
+	}
+	return ft.view.slot(seq), nil
+}
+
+// saveString writes val to the file and returns its offset
+func (ft *FileSymbolTab) saveString(val string) (uint64, error) {
+	h := &ft.view.h
+	n := 4 + uint64(len(val))
+	var offset uint64
+	if n > h.strEnd-h.strPos && n > fileChunkLen/4 {
+		// Large strings get an extent of their own
+		var err error
+		if offset, err = ft.alloc(n); err != nil {
+			return 0, err
+		}
+	} else {
+		if n > h.strEnd-h.strPos {
+			chunk, err := ft.alloc(fileChunkLen)
+			if err != nil {
+				return 0, err
+			}
+			h.strPos, h.strEnd = chunk, chunk+fileChunkLen
+		}
+		offset = h.strPos
+		h.strPos = (offset + n + 3) &^ 3
+	}
+
+	*(*uint32)(unsafe.Pointer(&ft.data[offset])) = uint32(len(val))
+	copy(ft.data[offset+4:], val)
+	return offset, nil
+}
+
+// alloc allocates n zeroed bytes at the end of the file and returns their
+// offset. The bytes may have been written before a crash, so we clear them.
+func (ft *FileSymbolTab) alloc(n uint64) (uint64, error) {
+	h := &ft.view.h
+	offset := (h.end + 7) &^ 7
+	if n > fileMaxSize-offset {
+		return 0, ErrFull
+	}
+	if err := ft.extend(offset + n); err != nil {
+		return 0, err
+	}
+	clear(ft.data[offset : offset+n])
+	h.end = offset + n
+	return offset, nil
+}
+
+// extend makes the file at least end bytes long. We write zeros rather than
+// truncating so that the disk space is allocated now. If the disk is full we
+// get an error here, rather than a SIGBUS when we write to the mapping.
+func (ft *FileSymbolTab) extend(end uint64) error {
+	if end <= ft.size {
+		return nil
+	}
+	size := min(max(end, ft.size+ft.size/4, fileDataStart+fileChunkLen), fileMaxSize)
+	zeros := make([]byte, min(size-ft.size, 1<<20))
+	for ft.size < size {
+		n, err := ft.f.WriteAt(zeros[:min(size-ft.size, uint64(len(zeros)))], int64(ft.size))
+		ft.size += uint64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MappedSymbolTab is a read-only symbol table backed by a memory-mapped file.
+// Open it with OpenFile. The same file may be opened by any number of
+// processes at once, and they share the same physical memory.
+type MappedSymbolTab struct {
+	data []byte
+	view fileView
+}
+
+// OpenFile maps a symbol table file read-only. It sees the strings as of the
+// last Sync or Close of the file, even if a FileSymbolTab is adding strings to
+// it. Only the header is checked, so this is very fast even for very large
+// tables. Call Verify to check the whole file.
+func OpenFile(path string) (*MappedSymbolTab, error) {
+	if !littleEndian() {
+		return nil, fmt.Errorf("%w: only supported on little-endian systems", ErrInvalidFormat)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < fileDataStart {
+		return nil, fmt.Errorf("%w: file too short", ErrInvalidFormat)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := readFileHeader(data, uint64(size))
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+
+	m := &MappedSymbolTab{
+		data: data,
+		view: fileView{data: data, h: h},
+	}
+	m.view.setTable()
+	return m, nil
+}
+
+// Close unmaps the file. Strings returned from the MappedSymbolTab are not
+// valid after Close is called.
+func (m *MappedSymbolTab) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	*m = MappedSymbolTab{}
+	return err
+}
+
+// Verify checks that every string is intact and can be found in the table, and
+// returns ErrChecksum if not. This reads every page of the file that is in
+// use.
+func (m *MappedSymbolTab) Verify() error {
+	return m.view.verify()
+}
+
+// Len returns the number of unique strings stored
+func (m *MappedSymbolTab) Len() int {
+	return m.view.len()
+}
+
+// SequenceToString looks up a string by its sequence number. The string refers
+// directly to the mapped file, so is only valid until Close is called. It
+// returns an empty string if seq is not valid.
+func (m *MappedSymbolTab) SequenceToString(seq uint32) string {
+	val, _ := m.view.lookup(seq)
+	return val
+}
+
+// LookupSequence looks up a string by its sequence number. If seq is 0, has not
+// been allocated, or has been deleted, ok is false.
+func (m *MappedSymbolTab) LookupSequence(seq uint32) (val string, ok bool) {
+	return m.view.lookup(seq)
+}
+
+// StringToSequence looks up the string val and returns its sequence number
+// seq. found indicates whether val is present. The table is read-only so
+// new strings cannot be added.
+func (m *MappedSymbolTab) StringToSequence(val string) (seq uint32, found bool) {
+	_, seq = m.view.find(val, fnv1a(val))
+	return seq, seq != 0
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// MappedSymbolTab, in sequence order. Deleted sequence numbers are skipped.
+func (m *MappedSymbolTab) All() iter.Seq2[uint32, string] {
+	return m.view.all()
+}
+
+// Strings returns an iterator over the strings in the MappedSymbolTab, in
+// sequence order.
+func (m *MappedSymbolTab) Strings() iter.Seq[string] {
+	return m.view.strings()
+}
+
+// fileView reads a symbol table file through a mapping, as described by one of
+// its headers. Everything outside the part of the file the header covers is
+// ignored, and offsets read from the file are checked before they are used.
+type fileView struct {
+	data    []byte
+	h       fileHeader
+	entries []tableEntry
+}
+
+func (v *fileView) setTable() {
+	v.entries = unsafe.Slice((*tableEntry)(unsafe.Pointer(&v.data[v.h.table])), v.h.tableLen)
+}
+
+func (v *fileView) uint64At(offset uint64) *uint64 {
+	return (*uint64)(unsafe.Pointer(&v.data[offset]))
+}
+
+func (v *fileView) len() int {
+	return int(v.h.count - v.h.deleted)
+}
+
+// slot returns where the string offset for seq is recorded, or nil if the
+// slab is missing. seq must be between 1 and the count.
+func (v *fileView) slot(seq uint32) *uint64 {
+	i := uint64(seq - 1)
+	slab := *v.uint64At(v.h.slabs + i/fileSlabLen*8)
+	if slab < fileDataStart || slab%8 != 0 || slab > v.h.end || v.h.end-slab < fileSlabLen*8 {
+		return nil
+	}
+	return v.uint64At(slab + i%fileSlabLen*8)
+}
+
+func (v *fileView) lookup(seq uint32) (string, bool) {
+	if seq == 0 || uint64(seq) > v.h.count {
+		return "", false
+	}
+	slot := v.slot(seq)
+	if slot == nil || *slot == 0 {
+		return "", false
+	}
+	return v.stringAt(*slot)
+}
+
+// stringAt returns the string stored at offset, if it is within the file
+func (v *fileView) stringAt(offset uint64) (string, bool) {
+	if offset < fileDataStart || offset > v.h.end-4 {
+		return "", false
+	}
+	l := uint64(*(*uint32)(unsafe.Pointer(&v.data[offset])))
+	if l > v.h.end-offset-4 {
+		return "", false
+	}
+	b := v.data[offset+4 : offset+4+l]
+	return unsafe.String(unsafe.SliceData(b), len(b)), true
+}
+
+// find looks for val in the table. If val is not present seq is 0 and cursor
+// is the empty entry where val belongs. Entries for sequence numbers beyond
+// the count were written after the header, so we skip them.
+func (v *fileView) find(val string, hash uint32) (cursor int, seq uint32) {
+	l := len(v.entries)
+	cursor = int(hash) & (l - 1)
+	for range l {
+		e := v.entries[cursor]
+		if e.sequence == 0 {
+			return cursor, 0
+		}
+		if e.hash == hash && uint64(e.sequence) <= v.h.count {
+			if s, ok := v.lookup(e.sequence); ok && s == val {
+				return cursor, e.sequence
+			}
+		}
+		cursor = (cursor + 1) & (l - 1)
+	}
+	return -1, 0
+}
+
+// place puts e in the first empty entry in its probe sequence
+func (v *fileView) place(e tableEntry) {
+	l := len(v.entries)
+	cursor := int(e.hash) & (l - 1)
+	for v.entries[cursor].sequence != 0 {
+		cursor = (cursor + 1) & (l - 1)
+	}
+	v.entries[cursor] = e
+}
+
+func (v *fileView) all() iter.Seq2[uint32, string] {
+	return func(yield func(uint32, string) bool) {
+		for seq := uint32(1); uint64(seq) <= v.h.count; seq++ {
+			if val, ok := v.lookup(seq); ok {
+				if !yield(seq, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *fileView) strings() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, val := range v.all() {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+// verify checks every string and table entry
+func (v *fileView) verify() error {
+	var live, deleted uint64
+	for seq := uint32(1); uint64(seq) <= v.h.count; seq++ {
+		slot := v.slot(seq)
+		if slot == nil {
+			return fmt.Errorf("%w: missing slab for sequence %d", ErrChecksum, seq)
+		}
+		if *slot == 0 {
+			deleted++
+			continue
+		}
+		val, ok := v.stringAt(*slot)
+		if !ok {
+			return fmt.Errorf("%w: string %d is out of bounds", ErrChecksum, seq)
+		}
+		if _, found := v.find(val, fnv1a(val)); found != seq {
+			return fmt.Errorf("%w: string %d is not in the table", ErrChecksum, seq)
+		}
+		live++
+	}
+	if deleted != v.h.deleted {
+		return fmt.Errorf("%w: %d sequence numbers deleted, header says %d", ErrChecksum, deleted, v.h.deleted)
+	}
+	var entries uint64
+	for _, e := range v.entries {
+		if e.sequence != 0 && uint64(e.sequence) <= v.h.count {
+			entries++
+		}
+	}
+	if entries != live {
+		return fmt.Errorf("%w: %d table entries for %d strings", ErrChecksum, entries, live)
+	}
+	return nil
+}
+
+type fileHeader struct {
+	generation uint64
+	count      uint64
+	deleted    uint64
+	end        uint64
+	table      uint64
+	tableLen   uint64
+	slabs      uint64
+	slabsCap   uint64
+	strPos     uint64
+	strEnd     uint64
+	flags      uint32
+}
+
+// readFileHeader picks the header to use from the two slots at the start of
+// data. It uses the valid slot with the higher generation. A slot that fails
+// its checksum was torn by a crash, so we fall back to the other one. But if
+// the newest header does not fit the file, the file is damaged and we don't
+// silently use an older header instead.
+func readFileHeader(data []byte, size uint64) (h fileHeader, err error) {
+	if size < fileDataStart {
+		return h, fmt.Errorf("%w: file too short", ErrInvalidFormat)
+	}
+	found := false
+	for slot := range 2 {
+		// Copy the slot, as a writer may be changing it
+		var buf [fileHeaderSize]byte
+		copy(buf[:], data[slot*fileHeaderSize:])
+		sh, serr := unmarshalFileHeader(buf[:])
+		if serr != nil {
+			if err == nil || errors.Is(serr, ErrChecksum) {
+				err = serr
+			}
+			continue
+		}
+		if !found || sh.generation > h.generation {
+			h, found = sh, true
+		}
+	}
+	if !found {
+		return h, err
+	}
+	return h, h.validate(size)
+}
+
+func (h *fileHeader) marshal(buf []byte) {
+	clear(buf)
+	copy(buf, fileMagic)
+	binary.LittleEndian.PutUint32(buf[8:], fileVersion)
+	binary.LittleEndian.PutUint32(buf[12:], fileHashFNV1a)
+	binary.LittleEndian.PutUint64(buf[16:], h.generation)
+	binary.LittleEndian.PutUint64(buf[24:], h.count)
+	binary.LittleEndian.PutUint64(buf[32:], h.deleted)
+	binary.LittleEndian.PutUint64(buf[40:], h.end)
+	binary.LittleEndian.PutUint64(buf[48:], h.table)
+	binary.LittleEndian.PutUint64(buf[56:], h.tableLen)
+	binary.LittleEndian.PutUint64(buf[64:], h.slabs)
+	binary.LittleEndian.PutUint64(buf[72:], h.slabsCap)
+	binary.LittleEndian.PutUint64(buf[80:], h.strPos)
+	binary.LittleEndian.PutUint64(buf[88:], h.strEnd)
+	binary.LittleEndian.PutUint32(buf[96:], h.flags)
+	binary.LittleEndian.PutUint32(buf[124:], crc32.Checksum(buf[:124], castagnoli))
+}
+
+func unmarshalFileHeader(buf []byte) (h fileHeader, err error) {
+	if string(buf[:8]) != fileMagic {
+		return h, fmt.Errorf("%w: bad magic number", ErrInvalidFormat)
+	}
+	if crc32.Checksum(buf[:124], castagnoli) != binary.LittleEndian.Uint32(buf[124:]) {
+		return h, fmt.Errorf("%w: header", ErrChecksum)
+	}
+	if v := binary.LittleEndian.Uint32(buf[8:]); v != fileVersion {
+		return h, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, v)
+	}
+	if hash := binary.LittleEndian.Uint32(buf[12:]); hash != fileHashFNV1a {
+		return h, fmt.Errorf("%w: unknown hash function %d", ErrInvalidFormat, hash)
+	}
+	h.generation = binary.LittleEndian.Uint64(buf[16:])
+	h.count = binary.LittleEndian.Uint64(buf[24:])
+	h.deleted = binary.LittleEndian.Uint64(buf[32:])
+	h.end = binary.LittleEndian.Uint64(buf[40:])
+	h.table = binary.LittleEndian.Uint64(buf[48:])
+	h.tableLen = binary.LittleEndian.Uint64(buf[56:])
+	h.slabs = binary.LittleEndian.Uint64(buf[64:])
+	h.slabsCap = binary.LittleEndian.Uint64(buf[72:])
+	h.strPos = binary.LittleEndian.Uint64(buf[80:])
+	h.strEnd = binary.LittleEndian.Uint64(buf[88:])
+	h.flags = binary.LittleEndian.Uint32(buf[96:])
+	return h, nil
+}
+
+// validate checks that the regions the header describes lie within a file of
+// size bytes, so that we can use them without further checks
+func (h *fileHeader) validate(size uint64) error {
+	within := func(offset, n uint64) bool {
+		return offset >= fileDataStart && offset%8 == 0 && offset <= h.end && n <= h.end-offset
+	}
+	if h.end > size || h.end > fileMaxSize ||
+		h.count >= math.MaxUint32 || h.deleted > h.count ||
+		h.tableLen < fileMinTableLen || h.tableLen > fileMaxTableLen || h.tableLen&(h.tableLen-1) != 0 ||
+		!within(h.table, h.tableLen*8) ||
+		h.slabsCap > h.end/8 || !within(h.slabs, h.slabsCap*8) ||
+		(h.count+fileSlabLen-1)/fileSlabLen > h.slabsCap ||
+		h.strPos > h.strEnd || h.strEnd > h.end {
+		return fmt.Errorf("%w: header does not match the file", ErrInvalidFormat)
+	}
+	return nil
+}
+
+// fnv1a is a stable hash function, for use where hashes must be the same
+// across processes
+func fnv1a(val string) uint32 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(val); i++ {
+		h ^= uint64(val[i])
+		h *= 1099511628211
+	}
+	return uint32(h ^ h>>32)
+}
+
+func littleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
@@ -0,0 +1,355 @@
+package offheap
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	// 8,500 entries leaves the table part way through a resize
+	for i := range 8_500 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+
+	path := filepath.Join(t.TempDir(), "symbols")
+	require.NoError(t, st.WriteFile(path))
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, m.Verify())
+
+	assert.Equal(t, 8_500, m.Len())
+	for i := range 8_500 {
+		seq, found := m.StringToSequence(strconv.Itoa(i))
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), m.SequenceToString(uint32(i+1)))
+	}
+
+	_, found := m.StringToSequence("hat")
+	assert.False(t, found)
+	assert.Equal(t, slices.Collect(st.Strings()), slices.Collect(m.Strings()))
+
+	// The file can be opened more than once
+	m2, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m2.Close()
+	seq, found := m2.StringToSequence("37")
+	assert.True(t, found)
+	assert.Equal(t, uint32(38), seq)
+}
+
+func TestFileEmpty(t *testing.T) {
+	var st SymbolTab
+	defer st.Close()
+	path := filepath.Join(t.TempDir(), "symbols")
+	require.NoError(t, st.WriteFile(path))
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.Zero(t, m.Len())
+	_, found := m.StringToSequence("")
+	assert.False(t, found)
+}
+
+func TestFileCorrupt(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 100 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "symbols")
+	require.NoError(t, st.WriteFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// The temporary file should have been renamed away
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	writeAndOpen := func(t *testing.T, data []byte) (*MappedSymbolTab, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "bad")
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return OpenFile(path)
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := writeAndOpen(t, data[:len(data)-1])
+		assert.True(t, errors.Is(err, ErrInvalidFormat), err)
+	})
+
+	t.Run("short", func(t *testing.T) {
+		_, err := writeAndOpen(t, data[:10])
+		assert.True(t, errors.Is(err, ErrInvalidFormat), err)
+	})
+
+	t.Run("header", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		bad[20]++
+		bad[fileHeaderSize+20]++
+		_, err := writeAndOpen(t, bad)
+		assert.True(t, errors.Is(err, ErrChecksum), err)
+	})
+
+	t.Run("body", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		bad[bytes.LastIndex(bad, []byte("99"))]++
+		m, err := writeAndOpen(t, bad)
+		require.NoError(t, err)
+		defer m.Close()
+		assert.True(t, errors.Is(m.Verify(), ErrChecksum))
+	})
+
+	t.Run("table", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		h, err := readFileHeader(bad, uint64(len(bad)))
+		require.NoError(t, err)
+		clear(bad[h.table : h.table+h.tableLen*8])
+		m, err := writeAndOpen(t, bad)
+		require.NoError(t, err)
+		defer m.Close()
+		assert.True(t, errors.Is(m.Verify(), ErrChecksum))
+	})
+}
+
+func TestFileWritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+	for i := range 10_000 {
+		seq, found := ft.StringToSequence(strconv.Itoa(i), true)
+		require.False(t, found)
+		require.Equal(t, uint32(i+1), seq)
+	}
+	require.NoError(t, ft.Close())
+
+	// A new FileSymbolTab can carry on where the last one left off
+	ft, err = OpenWritable(path)
+	require.NoError(t, err)
+	defer ft.Close()
+	assert.Equal(t, 10_000, ft.Len())
+	seq, found := ft.StringToSequence("37", true)
+	assert.True(t, found)
+	assert.Equal(t, uint32(38), seq)
+	for i := 10_000; i < 20_000; i++ {
+		seq, found, err := ft.Insert(strconv.Itoa(i))
+		require.NoError(t, err)
+		require.False(t, found)
+		require.Equal(t, uint32(i+1), seq)
+	}
+	require.NoError(t, ft.Sync())
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, m.Verify())
+	assert.Equal(t, 20_000, m.Len())
+	var count int
+	for seq, val := range m.All() {
+		assert.Equal(t, strconv.Itoa(int(seq)-1), val)
+		count++
+	}
+	assert.Equal(t, 20_000, count)
+}
+
+func TestFileLongString(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+	long := strings.Repeat("hat", fileChunkLen)
+	seq, _, err := ft.Insert("a")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), seq)
+	seq, _, err = ft.Insert(long)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), seq)
+	seq, _, err = ft.Insert("b")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), seq)
+	require.NoError(t, ft.Close())
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, m.Verify())
+	assert.Equal(t, []string{"a", long, "b"}, slices.Collect(m.Strings()))
+}
+
+func TestFileLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+
+	_, err = OpenWritable(path)
+	assert.True(t, errors.Is(err, ErrLocked), err)
+
+	require.NoError(t, ft.Close())
+	ft, err = OpenWritable(path)
+	require.NoError(t, err)
+	require.NoError(t, ft.Close())
+}
+
+func TestFileMappedLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+	for i := range 10 {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NoError(t, ft.Close())
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+	for _, seq := range []uint32{0, 11, math.MaxUint32} {
+		_, ok := m.LookupSequence(seq)
+		assert.False(t, ok)
+		assert.Equal(t, "", m.SequenceToString(seq))
+	}
+	val, ok := m.LookupSequence(10)
+	assert.True(t, ok)
+	assert.Equal(t, "9", val)
+}
+
+// crashCopy copies the file at path as it is now, as if the process writing
+// it had crashed
+func crashCopy(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	crashed := filepath.Join(t.TempDir(), "crashed")
+	require.NoError(t, os.WriteFile(crashed, data, 0o600))
+	return crashed
+}
+
+func TestFileCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+	defer ft.Close()
+	for i := range 100 {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NoError(t, ft.Sync())
+	// These are lost in the crash. There are enough to grow the table and
+	// start a new slab.
+	for i := 100; i < 5_000; i++ {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	crashed := crashCopy(t, path)
+
+	m, err := OpenFile(crashed)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, m.Verify())
+	assert.Equal(t, 100, m.Len())
+	_, found := m.StringToSequence("150")
+	assert.False(t, found)
+
+	ft2, err := OpenWritable(crashed)
+	require.NoError(t, err)
+	defer ft2.Close()
+	assert.Equal(t, 100, ft2.Len())
+	for i := 100; i < 200; i++ {
+		_, found := ft2.StringToSequence(strconv.Itoa(i), false)
+		assert.False(t, found)
+	}
+	seq, found, err := ft2.Insert("150")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, uint32(101), seq)
+	seq, found = ft2.StringToSequence("50", true)
+	assert.True(t, found)
+	assert.Equal(t, uint32(51), seq)
+	require.NoError(t, ft2.Close())
+
+	m2, err := OpenFile(crashed)
+	require.NoError(t, err)
+	defer m2.Close()
+	assert.NoError(t, m2.Verify())
+	assert.Equal(t, 101, m2.Len())
+	assert.Equal(t, "150", m2.SequenceToString(101))
+}
+
+func TestFileTornHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+	defer ft.Close()
+	for i := range 100 {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NoError(t, ft.Sync())
+	for i := 100; i < 200; i++ {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NoError(t, ft.Sync())
+	crashed := crashCopy(t, path)
+
+	// Damage the newest header, as if we crashed while writing it
+	data, err := os.ReadFile(crashed)
+	require.NoError(t, err)
+	slot := ft.view.h.generation % 2 * fileHeaderSize
+	data[slot+30]++
+	require.NoError(t, os.WriteFile(crashed, data, 0o600))
+
+	m, err := OpenFile(crashed)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.NoError(t, m.Verify())
+	assert.Equal(t, 100, m.Len())
+}
+
+func TestFileReadWhileWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols")
+	ft, err := OpenWritable(path)
+	require.NoError(t, err)
+	defer ft.Close()
+	for i := range 100 {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NoError(t, ft.Sync())
+
+	m, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m.Close()
+
+	// Add enough to move the table and the slab directory
+	for i := 100; i < 100_000; i++ {
+		ft.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NoError(t, ft.Sync())
+
+	// The reader still sees the file as it was when it opened it
+	assert.NoError(t, m.Verify())
+	assert.Equal(t, 100, m.Len())
+	seq, found := m.StringToSequence("99")
+	assert.True(t, found)
+	assert.Equal(t, uint32(100), seq)
+	_, found = m.StringToSequence("100")
+	assert.False(t, found)
+
+	m2, err := OpenFile(path)
+	require.NoError(t, err)
+	defer m2.Close()
+	assert.NoError(t, m2.Verify())
+	assert.Equal(t, 100_000, m2.Len())
+}
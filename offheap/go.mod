@@ -5,10 +5,19 @@ go 1.25
 require (
 	github.com/philpearl/mmap v0.0.1
 	github.com/philpearl/stringbank/offheap v1.0.3
+	github.com/philpearl/symboltab v1.1.1
 	github.com/stretchr/testify v1.3.0
+	github.com/zeebo/xxh3 v1.1.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
+	github.com/philpearl/stringbank v1.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
+
+// The root module is only used by tests, which check offheap.SymbolTab
+// against symboltab.Table and the metrics package
+replace github.com/philpearl/symboltab => ../
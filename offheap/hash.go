@@ -0,0 +1,93 @@
+package offheap
+
+import (
+	"hash/maphash"
+	"math/rand/v2"
+	"unsafe"
+
+	"github.com/philpearl/symboltab/offheap/internal/wyhash"
+	"github.com/zeebo/xxh3"
+)
+
+// Hash is a hash function for a SymbolTab. Choose one of the predefined hash
+// functions, or make your own with HashCustom, and pass it to NewWithHash. The
+// zero value is HashRuntime.
+//
+// Only the bottom 32 bits of the hash are used.
+type Hash struct {
+	name string
+	sum  func(val string) uint64
+}
+
+var (
+	// HashRuntime is the Go runtime's string hash, the same as Go's maps use. It
+	// is the fastest, and is the default. Each table has its own random seed, so
+	// the hash values can't be predicted by anyone who can choose the strings to
+	// add. They are also different in each process.
+	HashRuntime = Hash{name: "runtime"}
+	// HashMaphash uses hash/maphash with a seed that is fixed for the life of
+	// the process. Like HashRuntime its values are different in each process.
+	HashMaphash = Hash{name: "maphash", sum: maphashString}
+	// HashXXH3 is the 64 bit XXH3 hash. Its values are the same in every process.
+	HashXXH3 = Hash{name: "xxh3", sum: xxh3.HashString}
+	// HashWyhash is wyhash. Its values are the same in every process.
+	HashWyhash = Hash{name: "wyhash", sum: wyhash.String}
+)
+
+// HashCustom makes a Hash from fn. name is used to describe the hash function.
+// fn must not modify or keep the slice it is passed.
+func HashCustom(name string, fn func([]byte) uint64) Hash {
+	return Hash{
+		name: name,
+		sum: func(val string) uint64 {
+			return fn(unsafe.Slice(unsafe.StringData(val), len(val)))
+		},
+	}
+}
+
+// String returns the name of the hash function
+func (h Hash) String() string {
+	if h.name == "" {
+		return HashRuntime.name
+	}
+	return h.name
+}
+
+// sum32 returns the hash of val for use in the table. seed is only used by
+// HashRuntime. The other hash functions are either seeded once per process or
+// are intended to be the same in every process.
+func (h Hash) sum32(val string, seed uintptr) uint32 {
+	if h.sum == nil {
+		return stringHash(val, seed)
+	}
+	return uint32(h.sum(val))
+}
+
+// sum64 is like sum32, but returns the whole hash. On 32 bit platforms
+// HashRuntime only has 32 bits.
+func (h Hash) sum64(val string, seed uintptr) uint64 {
+	if h.sum == nil {
+		return uint64(memhash(unsafe.Pointer(unsafe.StringData(val)), seed, uintptr(len(val))))
+	}
+	return h.sum(val)
+}
+
+var maphashSeed = maphash.MakeSeed()
+
+// newSeed returns a random seed for HashRuntime. It is never 0, so we can use 0
+// to mean we haven't chosen a seed yet.
+func newSeed() uintptr {
+	return uintptr(rand.Uint64()) | 1
+}
+
+func maphashString(val string) uint64 {
+	return maphash.String(maphashSeed, val)
+}
+
+// NewWithHash creates a new SymbolTab that uses the hash function hash. cap is
+// the initial capacity of the table.
+func NewWithHash(cap int, hash Hash) *SymbolTab {
+	st := New(cap)
+	st.hash = hash
+	return st
+}
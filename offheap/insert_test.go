@@ -0,0 +1,80 @@
+package offheap
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsert(t *testing.T) {
+	var st SymbolTab
+	defer st.Close()
+	for i := range 1000 {
+		seq, found, err := st.Insert(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	for i := range 1000 {
+		seq, found, err := st.Insert(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+}
+
+func TestInsertFull(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	st.StringToSequence("a", true)
+	st.maxSequence = tombstone - 1
+
+	_, _, err := st.Insert("b")
+	assert.True(t, errors.Is(err, ErrFull))
+	assert.Equal(t, 1, st.Len())
+	seq, found := st.StringToSequence("b", true)
+	assert.Zero(t, seq)
+	assert.False(t, found)
+
+	seq, found, err = st.Insert("a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+}
+
+func TestInsertAllocFailure(t *testing.T) {
+	// Nothing can allocate a table this large
+	var tab table
+	err := tab.init(1<<60, LayoutLinear)
+	assert.True(t, errors.Is(err, ErrAlloc))
+	assert.Nil(t, tab.entries)
+
+	// If New can't allocate the table we start small instead
+	st := New(1 << 58)
+	defer st.Close()
+	assert.Zero(t, st.Cap())
+	seq, found, err := st.Insert("a")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, uint32(1), seq)
+	assert.Equal(t, 16, st.Cap())
+
+	var t64 table64
+	assert.True(t, errors.Is(t64.init(1<<60), ErrAlloc))
+}
+
+func TestSymbolTab64Insert(t *testing.T) {
+	st := New64(16)
+	defer st.Close()
+	seq, found, err := st.Insert("a")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, uint64(1), seq)
+	seq, found, err = st.Insert("a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(1), seq)
+}
@@ -1,33 +1,57 @@
 package offheap
 
 import (
+	"fmt"
+
 	"github.com/philpearl/mmap"
 )
 
 const intbanksize = 1 << 12
 
+// intbank maps sequence numbers to stringbank offsets. Offsets are never
+// negative, so we use negative values to mark deleted sequence numbers. The
+// value for a deleted sequence number is -1 - the next deleted sequence number,
+// which links them into a free list.
 type intbank struct {
 	slabs [][]int
 }
 
 func (ib *intbank) close() {
 	for _, s := range ib.slabs {
-		mmap.Free(s)
+		if !isDeletedSlab(s) {
+			mmap.Free(s)
+		}
 	}
 	ib.slabs = nil
 }
 
-func (ib *intbank) save(sequence uint32, offset int) {
-	sequence-- // externally sequence starts at 1
-	slabNo := int(sequence / intbanksize)
-	slabOffset := int(sequence % intbanksize)
-
+// grow makes sure the intbank has space for sequence
+func (ib *intbank) grow(sequence uint32) error {
+	slabNo := int((sequence - 1) / intbanksize)
 	for len(ib.slabs) <= slabNo {
-		ns, _ := mmap.Alloc[int](intbanksize)
+		ns, err := mmap.Alloc[int](intbanksize)
+		if err != nil {
+			return fmt.Errorf("%w: intbank: %w", ErrAlloc, err)
+		}
 		ib.slabs = append(ib.slabs, ns)
 	}
+	return nil
+}
 
-	ib.slabs[slabNo][slabOffset] = offset
+// save records the offset for sequence. Call grow first if there might not be
+// space for sequence. If there isn't, and save can't make space, it panics.
+func (ib *intbank) save(sequence uint32, offset int) {
+	if err := ib.grow(sequence); err != nil {
+		panic(err)
+	}
+	ib.set(sequence, offset)
+}
+
+// set records the offset for sequence, which must already have space. Unlike
+// save it never allocates.
+func (ib *intbank) set(sequence uint32, offset int) {
+	sequence-- // externally sequence starts at 1
+	ib.slabs[sequence/intbanksize][sequence%intbanksize] = offset
 }
 
 func (ib *intbank) lookup(sequence uint32) int {
@@ -37,3 +61,66 @@ func (ib *intbank) lookup(sequence uint32) int {
 
 	return ib.slabs[slabNo][slabOffset]
 }
+
+// delete marks sequence as deleted. next is the next entry in the free list, or 0
+func (ib *intbank) delete(sequence uint32, next uint32) {
+	ib.save(sequence, -1-int(next))
+}
+
+// nextFree returns the sequence number following the deleted sequence in the
+// free list
+func (ib *intbank) nextFree(sequence uint32) uint32 {
+	return uint32(-1 - ib.lookup(sequence))
+}
+
+// deletedSlab stands in for slabs in which every sequence number has been
+// deleted. It is shared, and is never written to or freed.
+var deletedSlab = func() []int {
+	s := make([]int, intbanksize)
+	for j := range s {
+		s[j] = -1
+	}
+	return s
+}()
+
+func isDeletedSlab(slab []int) bool {
+	return &slab[0] == &deletedSlab[0]
+}
+
+// releaseDeleted replaces slabs in which every sequence number up to max has
+// been deleted with deletedSlab, and rebuilds the free list from the deleted
+// sequence numbers that are left. Sequence numbers in released slabs are not on
+// the new free list, so are never reused. It returns the head of the new free
+// list and the number of slabs released.
+func (ib *intbank) releaseDeleted(max uint32) (freeList uint32, released int) {
+	for slabNo := range int(max / intbanksize) {
+		slab := ib.slabs[slabNo]
+		if isDeletedSlab(slab) {
+			continue
+		}
+		deleted := true
+		for _, offset := range slab {
+			if offset >= 0 {
+				deleted = false
+				break
+			}
+		}
+		if deleted {
+			mmap.Free(slab)
+			ib.slabs[slabNo] = deletedSlab
+			released++
+		}
+	}
+
+	// We build the list backwards so the lowest sequence numbers are reused first
+	for seq := max; seq >= 1; seq-- {
+		if isDeletedSlab(ib.slabs[(seq-1)/intbanksize]) {
+			continue
+		}
+		if ib.lookup(seq) < 0 {
+			ib.delete(seq, freeList)
+			freeList = seq
+		}
+	}
+	return freeList, released
+}
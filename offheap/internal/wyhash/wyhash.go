@@ -0,0 +1,68 @@
+// Package wyhash is an implementation of the final version 3 of wyhash by
+// Wang Yi, with the default secret. See https://github.com/wangyi-fudan/wyhash.
+package wyhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"unsafe"
+)
+
+var secret = [4]uint64{0xa0761d6478bd642f, 0xe7037ed1a0b428db, 0x8ebc6af09c88c6e3, 0x589965cc75374cc1}
+
+// String returns the hash of s with a seed of 0. It does not allocate.
+func String(s string) uint64 {
+	return Hash(unsafe.Slice(unsafe.StringData(s), len(s)), 0)
+}
+
+// Hash returns the hash of p with the given seed
+func Hash(p []byte, seed uint64) uint64 {
+	l := uint64(len(p))
+	seed ^= secret[0]
+	var a, b uint64
+	switch {
+	case len(p) <= 16:
+		switch {
+		case len(p) >= 4:
+			q := (len(p) >> 3) << 2
+			a = r4(p)<<32 | r4(p[q:])
+			b = r4(p[len(p)-4:])<<32 | r4(p[len(p)-4-q:])
+		case len(p) > 0:
+			a = uint64(p[0])<<16 | uint64(p[len(p)>>1])<<8 | uint64(p[len(p)-1])
+		}
+	default:
+		if len(p) > 48 {
+			see1, see2 := seed, seed
+			for len(p) > 48 {
+				seed = mix(r8(p)^secret[1], r8(p[8:])^seed)
+				see1 = mix(r8(p[16:])^secret[2], r8(p[24:])^see1)
+				see2 = mix(r8(p[32:])^secret[3], r8(p[40:])^see2)
+				p = p[48:]
+			}
+			seed ^= see1 ^ see2
+		}
+		for len(p) > 16 {
+			seed = mix(r8(p)^secret[1], r8(p[8:])^seed)
+			p = p[16:]
+		}
+		// The last 16 bytes may overlap with bytes we've already used. p
+		// still has at least 16 bytes before it, so we step back into them.
+		p = unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(p)), len(p)-16)), 16)
+		a = r8(p)
+		b = r8(p[8:])
+	}
+	return mix(secret[1]^l, mix(a^secret[1], b^seed))
+}
+
+func mix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+func r8(p []byte) uint64 {
+	return binary.LittleEndian.Uint64(p)
+}
+
+func r4(p []byte) uint64 {
+	return uint64(binary.LittleEndian.Uint32(p))
+}
@@ -0,0 +1,13 @@
+//go:build !symboltab_nolinkname
+
+package offheap
+
+import "unsafe"
+
+// We use the runtime's map hash function without the overhead of using
+// hash/maphash. Build with the symboltab_nolinkname tag to avoid the
+// go:linkname.
+//
+//go:linkname memhash runtime.memhash
+//go:noescape
+func memhash(p unsafe.Pointer, seed, s uintptr) uintptr
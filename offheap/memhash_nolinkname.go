@@ -0,0 +1,26 @@
+//go:build symboltab_nolinkname
+
+package offheap
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"unsafe"
+)
+
+var memhashSeed = maphash.MakeSeed()
+
+// memhash stands in for the runtime's hash function when we're built with the
+// symboltab_nolinkname tag. Like the runtime's hash it is seeded randomly in
+// each process.
+func memhash(p unsafe.Pointer, seed, s uintptr) uintptr {
+	var h maphash.Hash
+	h.SetSeed(memhashSeed)
+	if seed != 0 {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(seed))
+		h.Write(b[:])
+	}
+	h.Write(unsafe.Slice((*byte)(p), s))
+	return uintptr(h.Sum64())
+}
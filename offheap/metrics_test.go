@@ -0,0 +1,39 @@
+package offheap
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/philpearl/symboltab"
+	"github.com/philpearl/symboltab/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	reg := metrics.NewRegistry()
+	require.NoError(t, reg.Register("offheap", metrics.SourceFunc(func() symboltab.Stats {
+		return symboltab.Stats(st.Stats())
+	})))
+
+	srv := httptest.NewServer(reg.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "symboltab_strings{table=\"offheap\"} 1000\n")
+	assert.Contains(t, string(body), "symboltab_resizes_total{table=\"offheap\"} 6\n")
+	assert.Contains(t, string(body), "symboltab_memory_bytes{table=\"offheap\",area=\"intbank\"} "+strconv.Itoa(intbanksize*8)+"\n")
+}
@@ -0,0 +1,239 @@
+package offheap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ErrInvalidOption is returned by NewWithOptions if an option is out of range,
+// or the options don't work together.
+var ErrInvalidOption = errors.New("symboltab: invalid option")
+
+const (
+	// migrateBatch is the default number of entries copied from the old table
+	// to the new one each time a string is added during a resize
+	migrateBatch = 16
+	// maxMaxLoad is the highest load WithMaxLoad accepts. Past this, runs of
+	// full entries get long and lookups slow down a lot.
+	maxMaxLoad = 0.9
+)
+
+// Option configures a SymbolTab created by NewWithOptions
+type Option func(*options) error
+
+type options struct {
+	cap         int
+	intbankSize int
+	hash        Hash
+	tuning
+}
+
+// tuning controls the layout of the hash table and how it grows. The zero value
+// gives the defaults used by New.
+type tuning struct {
+	maxLoad      float64
+	growth       int
+	migrateBatch int
+	layout       Layout
+}
+
+// Layout is the way the hash table is arranged. It has the same values as
+// symboltab.Layout. See WithLayout.
+type Layout int
+
+const (
+	// LayoutLinear keeps the hash table as a single run of entries. See
+	// symboltab.LayoutLinear.
+	LayoutLinear Layout = iota
+	// LayoutSwiss splits the hash table into groups of 8 entries with a
+	// control byte for each entry, in the style of Go's swiss map. See
+	// symboltab.LayoutSwiss.
+	LayoutSwiss
+)
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutLinear:
+		return "linear"
+	case LayoutSwiss:
+		return "swiss"
+	}
+	return fmt.Sprintf("Layout(%d)", int(l))
+}
+
+// WithCapacity sets the number of strings the table can hold before it needs
+// to grow. The default is 0, which gives the smallest table.
+func WithCapacity(cap int) Option {
+	return func(o *options) error {
+		if cap < 0 {
+			return fmt.Errorf("%w: capacity %d is negative", ErrInvalidOption, cap)
+		}
+		o.cap = cap
+		return nil
+	}
+}
+
+// WithMaxLoad sets how full the hash table may get before it grows, as a
+// fraction of its size. It must be greater than 0 and at most 0.9. The default
+// is 0.5. Higher loads use less memory but make lookups step over more entries.
+func WithMaxLoad(load float64) Option {
+	return func(o *options) error {
+		if !(load > 0 && load <= maxMaxLoad) {
+			return fmt.Errorf("%w: max load %v is not in (0, %v]", ErrInvalidOption, load, maxMaxLoad)
+		}
+		o.maxLoad = load
+		return nil
+	}
+}
+
+// WithGrowth sets how many times larger the hash table gets each time it
+// grows. Table sizes are always powers of 2, so factor must be a power of 2
+// and at least 2. The default is 2.
+func WithGrowth(factor int) Option {
+	return func(o *options) error {
+		if factor < 2 || factor&(factor-1) != 0 {
+			return fmt.Errorf("%w: growth factor %d is not a power of 2 greater than 1", ErrInvalidOption, factor)
+		}
+		o.growth = factor
+		return nil
+	}
+}
+
+// WithMigrationBatch sets how many entries are copied from the old hash table
+// to the new one each time a string is added while the table is growing. Larger
+// batches finish the move sooner, but make those inserts slower. The default is
+// 16.
+//
+// The batch must be large enough that the move finishes before the new table
+// gets fuller than the max load. That means batch * max load must be at least 2.
+func WithMigrationBatch(batch int) Option {
+	return func(o *options) error {
+		if batch < 1 {
+			return fmt.Errorf("%w: migration batch %d is less than 1", ErrInvalidOption, batch)
+		}
+		o.migrateBatch = batch
+		return nil
+	}
+}
+
+// WithLayout sets the layout of the hash table. The default is LayoutLinear.
+func WithLayout(layout Layout) Option {
+	return func(o *options) error {
+		if layout != LayoutLinear && layout != LayoutSwiss {
+			return fmt.Errorf("%w: unknown layout %v", ErrInvalidOption, layout)
+		}
+		o.layout = layout
+		return nil
+	}
+}
+
+// WithIntbankSize allocates space up front to map n sequence numbers to their
+// strings. Normally this space is allocated as strings are added.
+//
+// There is no option to size the string storage up front. The stringbank
+// allocates it in fixed size chunks as strings are saved, and has no way to
+// reserve space in advance.
+func WithIntbankSize(n int) Option {
+	return func(o *options) error {
+		if n < 0 || n > math.MaxUint32 {
+			return fmt.Errorf("%w: intbank size %d is out of range", ErrInvalidOption, n)
+		}
+		o.intbankSize = n
+		return nil
+	}
+}
+
+// WithHash sets the hash function. See NewWithHash.
+func WithHash(hash Hash) Option {
+	return func(o *options) error {
+		o.hash = hash
+		return nil
+	}
+}
+
+// NewWithOptions creates a new SymbolTab configured by opts. It returns an error
+// wrapping ErrInvalidOption if any of the options are invalid, or ErrAlloc if
+// the table can't be allocated.
+func NewWithOptions(opts ...Option) (*SymbolTab, error) {
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.tuning.validate(); err != nil {
+		return nil, err
+	}
+
+	st := &SymbolTab{
+		tuning: o.tuning,
+		hash:   o.hash,
+		seed:   newSeed(),
+	}
+	if err := st.table.init(o.tableLen(o.cap), o.layout); err != nil {
+		return nil, err
+	}
+	if o.intbankSize > 0 {
+		if err := st.ib.grow(uint32(o.intbankSize)); err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// validate checks the settings work together. While the table grows, each
+// insert copies a batch of entries to the new table and may add one more. When
+// the table is rebuilt at the same size to clear out tombstones, the new table
+// starts with up to half the max load of live entries, and gets one insert for
+// every batch copied. For it not to get fuller than the max load before the
+// copy is done we need batch * max load >= 2. Growing to a larger table is
+// never worse than this.
+func (t tuning) validate() error {
+	if float64(t.batch())*t.load() < 2 {
+		return fmt.Errorf("%w: migration batch %d is too small for max load %v", ErrInvalidOption, t.batch(), t.load())
+	}
+	return nil
+}
+
+func (t tuning) load() float64 {
+	if t.maxLoad == 0 {
+		return 1.0 / loadFactor
+	}
+	return t.maxLoad
+}
+
+func (t tuning) growthFactor() int {
+	return max(t.growth, 2)
+}
+
+func (t tuning) batch() int {
+	if t.migrateBatch == 0 {
+		return migrateBatch
+	}
+	return t.migrateBatch
+}
+
+// growAt returns the number of entries, including tombstones, at which a table
+// of length l needs to grow
+func (t tuning) growAt(l int) int {
+	if t.maxLoad == 0 {
+		return l / loadFactor
+	}
+	return int(float64(l) * t.maxLoad)
+}
+
+// tableLen returns the length of table needed to hold cap strings without
+// growing
+func (t tuning) tableLen(cap int) int {
+	l := cap * loadFactor
+	if t.maxLoad != 0 {
+		l = int(math.Ceil(float64(cap) / t.maxLoad))
+	}
+	if l < 16 {
+		return 16
+	}
+	return 1 << uint(64-bits.LeadingZeros(uint(l-1)))
+}
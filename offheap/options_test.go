@@ -0,0 +1,123 @@
+package offheap
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "negative capacity", opts: []Option{WithCapacity(-1)}},
+		{name: "zero load", opts: []Option{WithMaxLoad(0)}},
+		{name: "load too high", opts: []Option{WithMaxLoad(0.95)}},
+		{name: "load NaN", opts: []Option{WithMaxLoad(math.NaN())}},
+		{name: "growth 1", opts: []Option{WithGrowth(1)}},
+		{name: "growth 3", opts: []Option{WithGrowth(3)}},
+		{name: "zero batch", opts: []Option{WithMigrationBatch(0)}},
+		{name: "negative intbank", opts: []Option{WithIntbankSize(-1)}},
+		{name: "intbank too big", opts: []Option{WithIntbankSize(math.MaxUint32 + 1)}},
+		{name: "unknown layout", opts: []Option{WithLayout(LayoutSwiss + 1)}},
+		{name: "batch too small for default load", opts: []Option{WithMigrationBatch(3)}},
+		{name: "batch too small for load", opts: []Option{WithMaxLoad(0.25), WithMigrationBatch(7)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st, err := NewWithOptions(test.opts...)
+			assert.True(t, errors.Is(err, ErrInvalidOption), err)
+			assert.Nil(t, st)
+		})
+	}
+}
+
+func TestNewWithOptionsDefaults(t *testing.T) {
+	st, err := NewWithOptions(WithCapacity(1000))
+	require.NoError(t, err)
+	defer st.Close()
+	st2 := New(1000)
+	defer st2.Close()
+	assert.Equal(t, st2.Cap(), st.Cap())
+	assert.Equal(t, tuning{}, st.tuning)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	st, err := NewWithOptions(
+		WithCapacity(1000),
+		WithMaxLoad(0.9),
+		WithGrowth(4),
+		WithMigrationBatch(8),
+		WithIntbankSize(2000),
+		WithHash(HashXXH3),
+	)
+	require.NoError(t, err)
+	defer st.Close()
+	assert.Equal(t, 2048, st.Cap())
+	assert.Len(t, st.ib.slabs, 1)
+	assert.Equal(t, HashXXH3.String(), st.hash.String())
+
+	// 1843 strings fit in the table at a load of 0.9
+	for i := range 1843 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Equal(t, 2048, st.Cap())
+	st.StringToSequence("one more", true)
+	assert.Equal(t, 8192, st.Cap())
+	assert.Equal(t, 1, st.Stats().Resizes)
+
+	for i := range 100_000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Equal(t, 131072, st.Cap())
+	for i := range 100_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		require.True(t, found)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(seq))
+	}
+
+	// The tuning survives renumbering
+	st.Delete("37")
+	_, err = st.Renumber()
+	require.NoError(t, err)
+	assert.Equal(t, tuning{maxLoad: 0.9, growth: 4, migrateBatch: 8}, st.tuning)
+	assert.Equal(t, 131072, st.Cap())
+}
+
+func TestNewWithOptionsSmallestBatch(t *testing.T) {
+	// With the smallest batch allowed for the load, repeatedly rebuilding the
+	// table to clear out tombstones must not let the new table get fuller than
+	// the max load.
+	for _, load := range []float64{0.25, 0.5, 0.75, 0.9} {
+		batch := int(2/load + 0.999)
+		st, err := NewWithOptions(WithMaxLoad(load), WithMigrationBatch(batch))
+		require.NoError(t, err)
+		defer st.Close()
+
+		for i := range 50_000 {
+			st.StringToSequence(strconv.Itoa(i), true)
+			if i >= 100 {
+				st.Delete(strconv.Itoa(i - 100))
+			}
+			if i%97 == 0 {
+				var used int
+				for _, e := range st.table.entries {
+					if e.sequence != 0 {
+						used++
+					}
+				}
+				require.True(t, used <= st.tuning.growAt(st.Cap())+1, "load %v, %d of %d used", load, used, st.Cap())
+			}
+		}
+		assert.Equal(t, 100, st.Len())
+		for i := 49_900; i < 50_000; i++ {
+			_, found := st.StringToSequence(strconv.Itoa(i), false)
+			assert.True(t, found)
+		}
+	}
+}
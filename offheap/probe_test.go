@@ -0,0 +1,83 @@
+package offheap
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collidingStrings finds n strings that all hash to the same slot in a table
+// of size l, if the table's seed is seed. This is what someone trying to flood
+// the table would do if they could predict the hash.
+func collidingStrings(n, l int, seed uintptr) []string {
+	var vals []string
+	for j := 0; len(vals) < n; j++ {
+		val := "collide" + strconv.Itoa(j)
+		if int(stringHash(val, seed))&(l-1) == 0 {
+			vals = append(vals, val)
+		}
+	}
+	return vals
+}
+
+func TestProbeTargetedCollisions(t *testing.T) {
+	vals := collidingStrings(200, 2048, 1)
+
+	// A table with the seed the strings were chosen for degrades badly, and
+	// we report it
+	st := New(1000)
+	st.seed = 1
+	for _, val := range vals {
+		st.StringToSequence(val, true)
+	}
+	count, longest := st.LongProbes()
+	assert.NotZero(t, count)
+	assert.Equal(t, 199, longest)
+
+	// But the same strings in a normally seeded table are spread out
+	st = New(1000)
+	for _, val := range vals {
+		st.StringToSequence(val, true)
+	}
+	for _, val := range vals {
+		seq, found := st.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, val, st.SequenceToString(seq))
+	}
+	count, longest = st.LongProbes()
+	assert.Zero(t, count)
+	assert.Zero(t, longest)
+}
+
+func TestProbeSeedsDiffer(t *testing.T) {
+	var st SymbolTab
+	st.StringToSequence("a", true)
+	assert.NotZero(t, st.seed)
+	assert.NotEqual(t, st.seed, New(0).seed)
+}
+
+func TestSetProbeLimit(t *testing.T) {
+	vals := collidingStrings(20, 2048, 1)
+	st := New(1000)
+	st.seed = 1
+
+	var reported []int
+	st.SetProbeLimit(10, func(probes int) {
+		reported = append(reported, probes)
+	})
+	for _, val := range vals {
+		st.StringToSequence(val, true)
+	}
+	// The 12th string added steps over 11 entries
+	assert.Equal(t, []int{11, 12, 13, 14, 15, 16, 17, 18, 19}, reported)
+	count, longest := st.LongProbes()
+	assert.Equal(t, 9, count)
+	assert.Equal(t, 19, longest)
+
+	// Back to the default limit
+	st.SetProbeLimit(0, nil)
+	st.StringToSequence(vals[19], false)
+	count, _ = st.LongProbes()
+	assert.Equal(t, 9, count)
+}
@@ -0,0 +1,61 @@
+package offheap
+
+// Renumber gives the live strings in the SymbolTab new sequence numbers that run
+// from 1 to Len() with no gaps, keeping them in the same order. It returns a
+// slice that maps old sequence numbers to new ones, so callers can rewrite any
+// data that refers to the old sequence numbers. The slice has an entry for every
+// old sequence number. Entries for deleted sequence numbers are 0.
+//
+// Renumber copies the live strings into fresh storage, so it also reclaims the
+// space used by deleted strings. Strings previously returned by the SymbolTab
+// are not valid after Renumber.
+//
+// If the memory for the new table and sequence numbers can't be allocated,
+// Renumber returns an error wrapping ErrAlloc and the SymbolTab is unchanged.
+func (i *SymbolTab) Renumber() ([]uint32, error) {
+	n := &SymbolTab{tuning: i.tuning}
+	if err := n.table.init(i.tuning.tableLen(i.count), i.tuning.layout); err != nil {
+		return nil, err
+	}
+	if i.count > 0 {
+		if err := n.ib.grow(uint32(i.count)); err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+	n.recycle = i.recycle
+	n.hash = i.hash
+	n.seed = i.seed
+	n.probeLimit = i.probeLimit
+	n.onLongProbe = i.onLongProbe
+
+	// Finish any resize so every entry is in the current table
+	for i.oldTable.len() != 0 {
+		i.resizeWork()
+	}
+
+	mapping := make([]uint32, i.maxSequence+1)
+	for seq := uint32(1); seq <= i.maxSequence; seq++ {
+		if offset := i.ib.lookup(seq); offset >= 0 {
+			n.maxSequence++
+			n.ib.set(n.maxSequence, n.sb.Save(i.sb.Get(offset)))
+			mapping[seq] = n.maxSequence
+		}
+	}
+	n.count = int(n.maxSequence)
+
+	// The hashes don't change, so we can build the new table from the old one
+	// without rehashing any strings
+	for _, entry := range i.table.entries {
+		if entry.live() {
+			n.copyEntryToTable(n.table, tableEntry{
+				hash:     entry.hash,
+				sequence: mapping[entry.sequence],
+			})
+		}
+	}
+
+	i.Close()
+	*i = *n
+	return mapping, nil
+}
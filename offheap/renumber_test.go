@@ -0,0 +1,93 @@
+package offheap
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenumber(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	// 8,500 entries leaves the table part way through a resize
+	const n = 8_500
+	for i := range n {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+	for i := 0; i < n; i += 3 {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	live := st.Len()
+
+	mapping, err := st.Renumber()
+	require.NoError(t, err)
+	require.Len(t, mapping, n+1)
+	assert.Equal(t, live, st.Len())
+	assert.Zero(t, st.oldTable.len())
+
+	var next uint32
+	for i := range n {
+		val := strconv.Itoa(i)
+		newSeq := mapping[i+1]
+		if i%3 == 0 {
+			assert.Zero(t, newSeq)
+			_, found := st.StringToSequence(val, false)
+			assert.False(t, found)
+			continue
+		}
+		// Sequence numbers are dense and in the same order as before
+		next++
+		assert.Equal(t, next, newSeq)
+		seq, found := st.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, newSeq, seq)
+		assert.Equal(t, val, st.SequenceToString(seq))
+	}
+	assert.Equal(t, uint32(live), next)
+	_, ok := st.LookupSequence(uint32(live + 1))
+	assert.False(t, ok)
+
+	// New strings follow on from the renumbered ones
+	seq, found := st.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(live+1), seq)
+}
+
+func TestRenumberEmpty(t *testing.T) {
+	var st SymbolTab
+	defer st.Close()
+	mapping, err := st.Renumber()
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0}, mapping)
+	seq, _ := st.StringToSequence("a", true)
+	assert.Equal(t, uint32(1), seq)
+}
+
+func TestRenumberAllocFailure(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 100 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	st.Delete("37")
+
+	// Pretend there are too many strings to allocate a table for
+	st.count = 1 << 58
+	_, err := st.Renumber()
+	assert.True(t, errors.Is(err, ErrAlloc))
+	st.count = 99
+
+	// The SymbolTab is unchanged
+	assert.Equal(t, uint32(100), st.maxSequence)
+	for i := range 100 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.Equal(t, i != 37, found)
+		if found {
+			assert.Equal(t, uint32(i+1), seq)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package offheap
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	st := New(1000)
+	defer st.Close()
+	s := st.Stats()
+	assert.Equal(t, 0, s.Len)
+	assert.Equal(t, 2048, s.Cap)
+	assert.Equal(t, 2048, s.Sampled)
+	assert.Zero(t, s.LoadFactor)
+	assert.Equal(t, 2048*8, s.TableBytes)
+	assert.False(t, s.Resizing)
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	st.Delete("37")
+	s = st.Stats()
+	assert.Equal(t, 999, s.Len)
+	assert.Equal(t, 1, s.Tombstones)
+	assert.Zero(t, s.Resizes)
+	assert.Equal(t, 1000.0/2048, s.LoadFactor)
+	assert.Equal(t, intbanksize*8, s.IntbankBytes)
+	assert.NotZero(t, s.StringBytes)
+
+	// The whole table is sampled, so every string is in the histogram
+	var total int
+	for _, n := range s.ProbeHistogram {
+		total += n
+	}
+	assert.Equal(t, 999, total)
+	assert.True(t, s.ProbeHistogram[0] > 500)
+	assert.True(t, s.MaxProbe < 64)
+}
+
+func TestStatsResizing(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 8_500 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	s := st.Stats()
+	assert.True(t, s.Resizing)
+	assert.Equal(t, 10, s.Resizes)
+	assert.Equal(t, 16384, s.OldTableLen)
+	assert.Equal(t, st.oldTableCursor, s.OldTableCursor)
+	assert.Equal(t, 16384*8, s.OldTableBytes)
+	assert.Equal(t, 32768*8, s.TableBytes)
+}
+
+func TestStatsCollisions(t *testing.T) {
+	// This hash only has two values, so all but two strings collide
+	first := HashCustom("first", func(b []byte) uint64 { return uint64(b[0]) })
+	st := NewWithHash(16, first)
+	defer st.Close()
+	for i := range 100 {
+		st.StringToSequence("a"+strconv.Itoa(i), true)
+		st.StringToSequence("b"+strconv.Itoa(i), true)
+	}
+	s := st.Stats()
+	assert.Equal(t, 198, s.Collisions)
+	// They're all in one run, so the last one has to step over the rest
+	assert.True(t, s.MaxProbe >= 198)
+	// Only the first a and the first b are where their hashes put them
+	assert.Equal(t, 2, s.ProbeHistogram[0])
+}
+
+func TestStatsSampled(t *testing.T) {
+	st := New(1 << 16)
+	defer st.Close()
+	for i := range 1 << 16 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	s := st.Stats()
+	assert.Equal(t, 1<<17, s.Cap)
+	assert.Equal(t, statsSampleSize, s.Sampled)
+
+	var total int
+	for _, n := range s.ProbeHistogram {
+		total += n
+	}
+	// About half the sampled entries are in use
+	assert.True(t, total > statsSampleSize/3 && total < statsSampleSize*2/3, total)
+}
+
+func BenchmarkStats(b *testing.B) {
+	st := New(1 << 20)
+	defer st.Close()
+	for i := range 1 << 20 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	b.ResetTimer()
+	for range b.N {
+		st.Stats()
+	}
+}
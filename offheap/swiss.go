@@ -0,0 +1,166 @@
+package offheap
+
+import "math/bits"
+
+// The swiss layout splits the hash table into groups of groupSize entries, in
+// the style of Go's swiss map. Alongside the entries we keep a control byte for
+// each entry, packed 8 to a uint64 so a whole group's control bytes can be
+// checked at once with a few word-wide operations. Unlike Go's map, but like
+// Abseil's SwissTable, the control bytes are kept apart from the entries. That
+// way the entries are a plain slice in both layouts, and only lookups and
+// inserts need to know about groups.
+//
+// The control byte of a full entry has the top bit set and 7 bits from the
+// top of the entry's hash below it. Empty entries are 0, so a newly allocated
+// table needs no initialisation, and deleted entries are ctrlDeleted.
+//
+// A lookup starts at the group picked by the bottom bits of the hash and looks
+// at the entries whose control byte matches. If there's no match and the group
+// has an empty entry the string isn't present, otherwise the lookup moves on to
+// the next group. The groups are visited in triangular order (1, 2, 3... groups
+// on from the last), which visits every group when the number of groups is a
+// power of 2.
+const groupSize = 8
+
+const (
+	ctrlEmpty   = 0x00
+	ctrlDeleted = 0x02
+	ctrlFull    = 0x80
+
+	ctrlLSBs = 0x0101010101010101
+	ctrlMSBs = 0x8080808080808080
+)
+
+// ctrlHash returns the control byte for a full entry with hash hash. The bottom
+// bits of the hash pick the group, so we use the top bits here.
+func ctrlHash(hash uint32) uint64 {
+	return ctrlFull | uint64(hash>>25)
+}
+
+// ctrlGroup is the control bytes for a group of entries. The control byte for
+// entry j of the group is byte j, counting from the least significant.
+type ctrlGroup uint64
+
+// matchHash returns the entries with control byte c, which must be a full
+// control byte from ctrlHash. This can give false positives for entries just
+// after a real match, so the caller must check the hash in the entry.
+func (g ctrlGroup) matchHash(c uint64) matches {
+	v := uint64(g) ^ (ctrlLSBs * c)
+	return matches((v - ctrlLSBs) &^ v & ctrlMSBs)
+}
+
+// matchEmpty returns the empty entries. Empty control bytes are the only ones
+// with neither the top bit nor bit 1 set.
+func (g ctrlGroup) matchEmpty() matches {
+	return matches(^uint64(g) &^ (uint64(g) << 6) & ctrlMSBs)
+}
+
+// matchEmptyOrDeleted returns the entries that are not full
+func (g ctrlGroup) matchEmptyOrDeleted() matches {
+	return matches(^uint64(g) & ctrlMSBs)
+}
+
+// matches is a set of entries in a group, with the top bit of byte j set if
+// entry j is in the set
+type matches uint64
+
+// first returns the index in the group of the first entry in the set. The set
+// must not be empty.
+func (m matches) first() int {
+	return bits.TrailingZeros64(uint64(m)) >> 3
+}
+
+// removeFirst returns the set without its first entry
+func (m matches) removeFirst() matches {
+	return m & (m - 1)
+}
+
+// setCtrl sets the control byte for the entry at cursor
+func (t table) setCtrl(cursor int, c uint64) {
+	shift := uint(cursor%groupSize) * 8
+	g := &t.ctrl[cursor/groupSize]
+	*g = *g&^(0xff<<shift) | c<<shift
+}
+
+// initCtrl sets all the control bytes from the entries
+func (t table) initCtrl() {
+	for cursor, e := range t.entries {
+		switch {
+		case e.sequence == tombstone:
+			t.setCtrl(cursor, ctrlDeleted)
+		case e.sequence != 0:
+			t.setCtrl(cursor, ctrlHash(e.hash))
+		}
+	}
+}
+
+// findInGroups is findInTable for the swiss layout
+func (i *SymbolTab) findInGroups(table table, val string, hashVal uint32) (cursor int, sequence uint32) {
+	mask := len(table.ctrl) - 1
+	g := int(hashVal) & mask
+	c := ctrlHash(hashVal)
+	insertAt := -1
+	for probes := 0; probes <= mask; probes++ {
+		ctrl := ctrlGroup(table.ctrl[g])
+		for m := ctrl.matchHash(c); m != 0; m = m.removeFirst() {
+			cursor := g*groupSize + m.first()
+			if e := table.entries[cursor]; e.hash == hashVal {
+				if i.sb.Get(int(i.ib.lookup(e.sequence))) == val {
+					i.checkProbes(probes * groupSize)
+					return cursor, e.sequence
+				}
+			}
+		}
+		if insertAt == -1 {
+			if m := ctrl.matchEmptyOrDeleted(); m != 0 {
+				insertAt = g*groupSize + m.first()
+			}
+		}
+		if ctrl.matchEmpty() != 0 {
+			i.checkProbes(probes * groupSize)
+			return insertAt, 0
+		}
+		g = (g + probes + 1) & mask
+	}
+	// We've looked at every group and none has an empty entry
+	i.checkProbes(len(table.entries))
+	return insertAt, 0
+}
+
+// copyEntryToGroups is copyEntryToTable for the swiss layout
+func (t table) copyEntryToGroups(entry tableEntry) {
+	mask := len(t.ctrl) - 1
+	g := int(entry.hash) & mask
+	for probes := 0; probes <= mask; probes++ {
+		if m := ctrlGroup(t.ctrl[g]).matchEmpty(); m != 0 {
+			t.set(g*groupSize+m.first(), entry)
+			return
+		}
+		g = (g + probes + 1) & mask
+	}
+	panic("out of space (resize)!")
+}
+
+// groupProbe returns the number of entries a lookup for the entry at cursor
+// steps over in the swiss layout, counting whole groups, and whether the
+// lookup passes an entry with the same hash first.
+func (t table) groupProbe(cursor int, hash uint32) (probes int, collision bool) {
+	mask := len(t.ctrl) - 1
+	g, target := int(hash)&mask, cursor/groupSize
+	for k := 0; ; k++ {
+		start := g * groupSize
+		end := start + groupSize
+		if g == target {
+			end = cursor
+		}
+		for _, o := range t.entries[start:end] {
+			if o.live() && o.hash == hash {
+				collision = true
+			}
+		}
+		if g == target {
+			return k * groupSize, collision
+		}
+		g = (g + k + 1) & mask
+	}
+}
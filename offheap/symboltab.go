@@ -6,8 +6,10 @@
 package offheap
 
 import (
+	"errors"
+	"fmt"
+	"iter"
 	"math"
-	"math/bits"
 	"unsafe"
 
 	"github.com/philpearl/mmap"
@@ -18,6 +20,19 @@ import (
 // increased to at least 16 bytes per entry
 const loadFactor = 2
 
+// tombstone is the sequence number we use in the table to mark entries that have been
+// deleted. Lookups step over tombstones, and new entries can be written over them.
+const tombstone = math.MaxUint32
+
+var (
+	// ErrFull is returned by Insert if the SymbolTab has no space or sequence
+	// numbers left for new strings
+	ErrFull = errors.New("symboltab: table is full")
+	// ErrAlloc is returned by Insert if memory for the SymbolTab can't be
+	// allocated. It wraps the error from the allocation.
+	ErrAlloc = errors.New("symboltab: allocation failed")
+)
+
 // SymbolTab is the symbol table. Allocate it via New()
 type SymbolTab struct {
 	sb             stringbank.Stringbank
@@ -26,22 +41,55 @@ type SymbolTab struct {
 	count          int
 	oldTableCursor int
 	ib             intbank
+
+	// maxSequence is the highest sequence number allocated. It can be larger than
+	// count if strings have been deleted.
+	maxSequence uint32
+	// tombstones is the number of tombstones in table
+	tombstones int
+	// resizes is the number of times the table has been replaced, either by a
+	// larger one or to clear out tombstones
+	resizes int
+	// reserveLen is the length StringsToSequences wants the next resize to
+	// grow the table to, if that is larger than it would normally grow. See
+	// reserve.
+	reserveLen int
+	// tuning controls how the table grows. See NewWithOptions.
+	tuning tuning
+	// freeList is the most recently deleted sequence number. The intbank entries for
+	// deleted sequence numbers link them into a list. See intbank.
+	freeList uint32
+	recycle  bool
+
+	// index is the sorted index used by PrefixScan and RangeScan. It is nil
+	// until one of them is called.
+	index *index
+
+	hash Hash
+	// seed is the seed for HashRuntime. It is chosen randomly when the table is
+	// created, which means that anyone who can choose the strings that are
+	// added can't easily find strings that collide.
+	seed uintptr
+
+	// probeLimit, onLongProbe, longProbes and longestProbe are for detecting
+	// lookups that have to step over a lot of entries. See SetProbeLimit.
+	probeLimit   int
+	onLongProbe  func(probes int)
+	longProbes   uint32
+	longestProbe uint32
 }
 
 // New creates a new SymbolTab. cap is the initial capacity of the table - it will grow
 // automatically when needed
 func New(cap int) *SymbolTab {
-	// want to allocate a table large enough to hold cap without growing
-	cap = cap * loadFactor
-	if cap < 16 {
-		cap = 16
-	} else {
-		cap = 1 << uint(64-bits.LeadingZeros(uint(cap-1)))
-	}
+	// want to allocate a table large enough to hold cap without growing. If
+	// we can't allocate the table now we'll try again with a small one when
+	// the first string is added, and report any error then.
 	var t table
-	t.init(cap)
+	t.init(tuning{}.tableLen(cap), LayoutLinear)
 	return &SymbolTab{
 		table: t,
+		seed:  newSeed(),
 	}
 }
 
@@ -52,6 +100,11 @@ func (i *SymbolTab) Close() {
 	i.oldTable.close()
 	i.oldTableCursor = 0
 	i.count = 0
+	i.maxSequence = 0
+	i.tombstones = 0
+	i.resizes = 0
+	i.freeList = 0
+	i.index = nil
 	i.ib.close()
 }
 
@@ -72,38 +125,115 @@ func (i *SymbolTab) SymbolSize() int {
 }
 
 // SequenceToString looks up a string by its sequence number. Obtain the sequence number
-// for a string with StringToSequence
+// for a string with StringToSequence. SequenceToString panics if seq is not a valid
+// sequence number, or has been deleted. Use LookupSequence if seq may not be valid.
 func (i *SymbolTab) SequenceToString(seq uint32) string {
 	// Look up the stringbank offset for this sequence number, then get the string
 	offset := i.ib.lookup(seq)
 	return i.sb.Get(offset)
 }
 
-// We use the runtime's map hash function without the overhead of using
-// hash/maphash
-//
-//go:linkname runtime_memhash runtime.memhash
-//go:noescape
-func runtime_memhash(p unsafe.Pointer, seed, s uintptr) uintptr
+// LookupSequence looks up a string by its sequence number. Unlike SequenceToString it
+// does not panic if seq is not valid. If nothing has been deleted, valid sequence
+// numbers run from 1 to Len() inclusive. If seq is 0, has not been allocated, or
+// has been deleted, ok is false.
+func (i *SymbolTab) LookupSequence(seq uint32) (val string, ok bool) {
+	if seq == 0 || seq > i.maxSequence {
+		return "", false
+	}
+	offset := i.ib.lookup(seq)
+	if offset < 0 {
+		return "", false
+	}
+	return i.sb.Get(offset), true
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// SymbolTab, in sequence order. Deleted sequence numbers are skipped. Strings
+// added during iteration may or may not be included.
+func (i *SymbolTab) All() iter.Seq2[uint32, string] {
+	return func(yield func(uint32, string) bool) {
+		for seq := uint32(1); seq <= i.maxSequence; seq++ {
+			if val, ok := i.LookupSequence(seq); ok {
+				if !yield(seq, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Strings returns an iterator over the strings in the SymbolTab, in sequence
+// order
+func (i *SymbolTab) Strings() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, val := range i.All() {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+// stringHash returns the hash we use for val in the table. Note that the
+// runtime's hash is randomised per process, so these hashes are only meaningful
+// within a single process. We also seed it differently for each table.
+func stringHash(val string, seed uintptr) uint32 {
+	return uint32(memhash(
+		unsafe.Pointer(unsafe.StringData(val)),
+		seed,
+		uintptr(len(val)),
+	))
+}
 
 // StringToSequence looks up the string val and returns its sequence number seq. If val does
 // not currently exist in the symbol table, it will add it if addNew is true. found indicates
 // whether val was already present in the SymbolTab
+//
+// If val can't be added, StringToSequence returns 0. Use Insert to find out
+// why.
 func (i *SymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
+	if addNew && i.seed == 0 {
+		i.initSeed()
+	}
+	seq, found, _ = i.stringToSequence(val, i.hash.sum32(val, i.seed), addNew)
+	return seq, found
+}
+
+// Insert looks up the string val and returns its sequence number seq, adding
+// val if it is not already present. found indicates whether val was already
+// present.
+//
+// Unlike StringToSequence, Insert returns an error if val can't be added. The
+// error is ErrFull if the table is out of space or sequence numbers, or wraps
+// ErrAlloc if memory can't be allocated. The SymbolTab is unchanged and can
+// still be used.
+func (i *SymbolTab) Insert(val string) (seq uint32, found bool, err error) {
+	if i.seed == 0 {
+		i.initSeed()
+	}
+	return i.stringToSequence(val, i.hash.sum32(val, i.seed), true)
+}
+
+// initSeed chooses the hash seed for a zero value SymbolTab. It must be called
+// before hashing any string that is to be added.
+func (i *SymbolTab) initSeed() {
+	i.seed = newSeed()
+}
+
+// stringToSequence is Insert for when the caller already has the hash of val, and
+// may not want to add it
+func (i *SymbolTab) stringToSequence(val string, hash uint32, addNew bool) (seq uint32, found bool, err error) {
 	// we use a hashtable where the keys are stringbank offsets, but comparisons are done on
 	// strings. There is no value to store
 
-	hash := uint32(runtime_memhash(
-		unsafe.Pointer(unsafe.StringData(val)),
-		0,
-		uintptr(len(val)),
-	))
-
 	if addNew {
 		// We're going to add to the table, make sure it is big enough
 		// We make sure we don't do any resizing work if we're not writing data as it will surprise folk who
 		// might hold just a read lock while reading.
-		i.resize()
+		if err := i.resize(); err != nil {
+			return 0, false, err
+		}
 	}
 
 	if i.oldTable.len() != 0 {
@@ -117,65 +247,132 @@ func (i *SymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found
 		// only. Certainly if we add we want to add to the new table
 		_, sequence := i.findInTable(i.oldTable, val, hash)
 		if sequence != 0 {
-			return sequence, true
+			return sequence, true, nil
 		}
 	}
 
 	cursor, sequence := i.findInTable(i.table, val, hash)
 	if sequence != 0 {
-		return sequence, true
+		return sequence, true, nil
 	}
 
 	if !addNew {
-		return 0, false
+		return 0, false, nil
+	}
+	if cursor < 0 {
+		return 0, false, ErrFull
 	}
 
 	// String was not found, so we want to store it. Cursor is the index where we should
 	// store it
+	sequence, err = i.nextSequence()
+	if err != nil {
+		return 0, false, err
+	}
 	i.count++
-	sequence = uint32(i.count)
-	i.table.entries[cursor] = tableEntry{
+	if i.table.isTombstone(cursor) {
+		i.tombstones--
+	}
+	i.table.set(cursor, tableEntry{
 		hash:     hash,
 		sequence: sequence,
-	}
+	})
 
 	offset := i.sb.Save(val)
 	i.ib.save(sequence, offset)
+	i.indexAdd(sequence)
+
+	return sequence, false, nil
+}
+
+// BytesToSequence is like StringToSequence, but takes a byte slice. It does not
+// allocate, and val is only copied if it is added to the table.
+func (i *SymbolTab) BytesToSequence(val []byte, addNew bool) (seq uint32, found bool) {
+	// The string only lives for the duration of this call, and the stringbank
+	// copies it if it is saved, so it's safe to avoid the copy here.
+	return i.StringToSequence(unsafe.String(unsafe.SliceData(val), len(val)), addNew)
+}
 
-	return sequence, false
+// nextSequence returns the sequence number for a new string. This is a recycled
+// sequence number if recycling is on and there are any, otherwise the next unused one.
+// We make sure there is space in the intbank for the sequence number, so the caller
+// can save it without error.
+func (i *SymbolTab) nextSequence() (uint32, error) {
+	if i.recycle && i.freeList != 0 {
+		seq := i.freeList
+		i.freeList = i.ib.nextFree(seq)
+		return seq, nil
+	}
+	if i.maxSequence == tombstone-1 {
+		return 0, ErrFull
+	}
+	if err := i.ib.grow(i.maxSequence + 1); err != nil {
+		return 0, err
+	}
+	i.maxSequence++
+	return i.maxSequence, nil
 }
 
 // findInTable find the string val in the hash table. If the string is present, it returns the
-// place in the table where it was found, plus the stringbank offset of the string + 1
+// place in the table where it was found, plus the stringbank offset of the string + 1. If not
+// the cursor is where the string should be added. This may be a tombstone. If the
+// string is not present and the table has no space the cursor is -1.
 func (i *SymbolTab) findInTable(table table, val string, hashVal uint32) (cursor int, sequence uint32) {
 	l := table.len()
 	if l == 0 {
 		return 0, 0
 	}
+	if table.ctrl != nil {
+		return i.findInGroups(table, val, hashVal)
+	}
 	cursor = int(hashVal) & (l - 1)
 	start := cursor
+	insertAt := -1
+	probes := 0
 	for table.entries[cursor].sequence != 0 {
-		if table.entries[cursor].hash == hashVal {
-			if seq := table.entries[cursor].sequence; i.sb.Get(int(i.ib.lookup(seq))) == val {
+		if seq := table.entries[cursor].sequence; seq == tombstone {
+			if insertAt == -1 {
+				insertAt = cursor
+			}
+		} else if table.entries[cursor].hash == hashVal {
+			if i.sb.Get(int(i.ib.lookup(seq))) == val {
+				i.checkProbes(probes)
 				return cursor, seq
 			}
 		}
+		probes++
 		cursor++
 		cursor = cursor & (l - 1)
 		if cursor == start {
-			panic("out of space!")
+			if insertAt != -1 {
+				break
+			}
+			i.checkProbes(probes)
+			return -1, 0
 		}
 	}
+	i.checkProbes(probes)
+	if insertAt != -1 {
+		return insertAt, 0
+	}
 	return cursor, 0
 }
 
+// copyEntryToTable adds an entry to table. We only copy into tables that have more
+// space than the live entries in the table we're copying from, so it can't run out
+// of space.
 func (i *SymbolTab) copyEntryToTable(table table, entry tableEntry) {
+	if table.ctrl != nil {
+		table.copyEntryToGroups(entry)
+		return
+	}
 	l := table.len()
 	cursor := int(entry.hash) & (l - 1)
 	start := cursor
 	for table.entries[cursor].sequence != 0 {
 		// the entry we're copying in is guaranteed not to be already
-		// present, so we're just looking for an empty space
+		// present, so we're just looking for an empty space. We don't reuse
+		// tombstones here so we don't need to keep track of them.
 		cursor++
 		cursor = cursor & (l - 1)
 		if cursor == start {
@@ -186,23 +383,23 @@ func (i *SymbolTab) copyEntryToTable(table table, entry tableEntry) {
 }
 
 func (i *SymbolTab) resizeWork() {
-	// We copy items between tables 16 at a time. Since we do this every time
-	// anyone writes to the table we won't run out of space in the new table
-	// before this is complete
+	// We copy items between tables a batch at a time. Since we do this every
+	// time anyone writes to the table we won't run out of space in the new
+	// table before this is complete. See tuning.validate.
 	l := i.oldTable.len()
 	if l == 0 {
 		return
 	}
-	// original size is 16, and we double to create new tables, so size should always be a multiple of 16
-	for _, entry := range i.oldTable.entries[i.oldTableCursor : i.oldTableCursor+16] {
-		if entry.sequence != 0 {
+	end := min(i.oldTableCursor+i.tuning.batch(), l)
+	for _, entry := range i.oldTable.entries[i.oldTableCursor:end] {
+		if entry.live() {
 			i.copyEntryToTable(i.table, entry)
 			// The entry can exist in the old and new versions of the table without
 			// problems. If we did try to delete from the old table we'd have issues
 			// searching forward from clashing entries.
 		}
 	}
-	i.oldTableCursor += 16
+	i.oldTableCursor = end
 	if i.oldTableCursor >= l {
 		// resizing is complete - clear out the old table
 		i.oldTable.close()
@@ -210,25 +407,36 @@ func (i *SymbolTab) resizeWork() {
 	}
 }
 
-func (i *SymbolTab) resize() {
+// resize starts growing the table if it is full enough. If it can't grow the
+// table it returns an error, and the table is unchanged.
+func (i *SymbolTab) resize() error {
 	if i.table.entries == nil {
 		// Makes zero value of SymbolTab useful
-		i.table.init(16)
+		if err := i.table.init(16, i.tuning.layout); err != nil {
+			return err
+		}
 	}
 
-	if i.count < i.table.len()/loadFactor {
+	if i.count+i.tombstones < i.tuning.growAt(i.table.len()) {
 		// Not full enough to grow the table
-		return
+		return nil
 	}
 
-	if i.table.len() >= math.MaxUint32 {
+	newLen := min(i.table.len()*i.tuning.growthFactor(), math.MaxUint32+1)
+	if i.reserveLen > newLen {
+		newLen = i.reserveLen
+	} else if i.count < i.tuning.growAt(i.table.len())/2 {
+		// The table is mostly full of tombstones. Tombstones aren't copied, so we can
+		// clear them out by copying to a table of the same size.
+		newLen = i.table.len()
+	} else if i.table.len() >= math.MaxUint32 {
 		// We can't grow the table any more. We can let the table get fuller
-		if i.count >= math.MaxUint32*3/4 {
+		if i.count+i.tombstones >= math.MaxUint32*3/4 {
 			// Things will probably go wrong if we get this full. We have no
 			// bits left to grow the table. This is the end.
-			panic("out of space in symboltab!")
+			return ErrFull
 		}
-		return
+		return nil
 	}
 
 	if i.oldTable.entries == nil {
@@ -236,9 +444,15 @@ func (i *SymbolTab) resize() {
 		// clever, just allocating these slices can cause a considerable amount of work, presumably because
 		// they are set to zero.
 		var newTable table
-		newTable.init(i.table.len() * 2)
+		if err := newTable.init(newLen, i.tuning.layout); err != nil {
+			return err
+		}
 		i.oldTable, i.table = i.table, newTable
+		i.tombstones = 0
+		i.reserveLen = 0
+		i.resizes++
 	}
+	return nil
 }
 
 // table represents a hash table. We keep the strings and hashes separate in
@@ -251,6 +465,9 @@ type table struct {
 	// the table when it's very large. I'd guess if the "value" of the table
 	// (the sequence number) was larger this might not be the case.
 	entries []tableEntry
+	// ctrl holds the control bytes for the swiss layout, one uint64 for each
+	// group of entries. It is nil for the linear layout. See swiss.go.
+	ctrl []uint64
 }
 
 type tableEntry struct {
@@ -258,17 +475,75 @@ type tableEntry struct {
 	sequence uint32
 }
 
-func (t *table) init(cap int) {
-	t.entries, _ = mmap.Alloc[tableEntry](cap)
+// live returns true if the entry is in use and is not a tombstone
+func (e tableEntry) live() bool {
+	return e.sequence != 0 && e.sequence != tombstone
+}
+
+func (t *table) init(cap int, layout Layout) (err error) {
+	if t.entries, err = mmap.Alloc[tableEntry](cap); err != nil {
+		return fmt.Errorf("%w: table of %d entries: %w", ErrAlloc, cap, err)
+	}
+	if layout == LayoutSwiss {
+		if t.ctrl, err = mmap.Alloc[uint64](cap / groupSize); err != nil {
+			t.close()
+			return fmt.Errorf("%w: control bytes for table of %d entries: %w", ErrAlloc, cap, err)
+		}
+	}
+	return nil
 }
 
 func (t table) len() int {
 	return len(t.entries)
 }
 
+// size returns the memory used by the table in bytes
+func (t table) size() int {
+	return len(t.entries)*int(unsafe.Sizeof(tableEntry{})) + len(t.ctrl)*int(unsafe.Sizeof(uint64(0)))
+}
+
+// isTombstone returns true if the entry at cursor is a tombstone. With the
+// swiss layout we can tell from the control byte, which saves reading an entry
+// that we're only going to write.
+func (t table) isTombstone(cursor int) bool {
+	if t.ctrl != nil {
+		return t.ctrl[cursor/groupSize]>>(cursor%groupSize*8)&0xff == ctrlDeleted
+	}
+	return t.entries[cursor].sequence == tombstone
+}
+
+// set stores entry at cursor
+func (t table) set(cursor int, entry tableEntry) {
+	t.entries[cursor] = entry
+	if t.ctrl != nil {
+		t.setCtrl(cursor, ctrlHash(entry.hash))
+	}
+}
+
+// remove deletes the entry at cursor. It returns true if it leaves a tombstone
+// in its place.
+func (t table) remove(cursor int) bool {
+	if t.ctrl != nil && ctrlGroup(t.ctrl[cursor/groupSize]).matchEmpty() != 0 {
+		// Lookups stop at a group with an empty entry, so none continue past
+		// this group. We can make the entry empty rather than a tombstone.
+		t.entries[cursor] = tableEntry{}
+		t.setCtrl(cursor, ctrlEmpty)
+		return false
+	}
+	t.entries[cursor] = tableEntry{sequence: tombstone}
+	if t.ctrl != nil {
+		t.setCtrl(cursor, ctrlDeleted)
+	}
+	return true
+}
+
 func (t *table) close() {
 	if t.entries != nil {
 		mmap.Free(t.entries)
 		t.entries = nil
 	}
+	if t.ctrl != nil {
+		mmap.Free(t.ctrl)
+		t.ctrl = nil
+	}
 }
@@ -0,0 +1,341 @@
+package offheap
+
+import (
+	"fmt"
+	"iter"
+	"math/bits"
+	"unsafe"
+
+	"github.com/philpearl/mmap"
+	stringbank "github.com/philpearl/stringbank/offheap"
+)
+
+// SymbolTab64 is a symbol table with 64 bit sequence numbers and hashes. Use it
+// instead of SymbolTab if you need to store more than about 3 billion strings.
+// SymbolTab's table is indexed by a 32 bit hash, so it can't grow past 2^32
+// entries, and its sequence numbers run out at 2^32.
+//
+// Table entries are 16 bytes rather than 8, so SymbolTab64 uses more memory per
+// string than SymbolTab. It does not support deleting strings. Allocate it via
+// New64()
+type SymbolTab64 struct {
+	sb             stringbank.Stringbank
+	table          table64
+	oldTable       table64
+	count          int
+	oldTableCursor int
+	ib             intbank64
+
+	// maxSequence is the highest sequence number allocated
+	maxSequence uint64
+
+	hash Hash
+	// seed is the seed for HashRuntime. See SymbolTab.
+	seed uintptr
+}
+
+// New64 creates a new SymbolTab64. cap is the initial capacity of the table -
+// it will grow automatically when needed
+func New64(cap int) *SymbolTab64 {
+	// want to allocate a table large enough to hold cap without growing
+	cap = cap * loadFactor
+	if cap < 16 {
+		cap = 16
+	} else {
+		cap = 1 << uint(64-bits.LeadingZeros(uint(cap-1)))
+	}
+	var t table64
+	t.init(cap)
+	return &SymbolTab64{
+		table: t,
+		seed:  newSeed(),
+	}
+}
+
+// NewWithHash64 creates a new SymbolTab64 that uses the hash function hash.
+// All 64 bits of the hash are used. cap is the initial capacity of the table.
+func NewWithHash64(cap int, hash Hash) *SymbolTab64 {
+	st := New64(cap)
+	st.hash = hash
+	return st
+}
+
+// Close releases resources associated with the SymbolTab64
+func (i *SymbolTab64) Close() {
+	i.sb.Close()
+	i.table.close()
+	i.oldTable.close()
+	i.oldTableCursor = 0
+	i.count = 0
+	i.maxSequence = 0
+	i.ib.close()
+}
+
+// Len returns the number of unique strings stored
+func (i *SymbolTab64) Len() int {
+	return i.count
+}
+
+// Cap returns the size of the SymbolTab64 table
+func (i *SymbolTab64) Cap() int {
+	return i.table.len()
+}
+
+// SymbolSize contains the approximate size of string storage in the symboltable. This will be an over-estimate and
+// includes as yet unused and wasted space
+func (i *SymbolTab64) SymbolSize() int {
+	return i.sb.Size()
+}
+
+// SequenceToString looks up a string by its sequence number. Obtain the
+// sequence number for a string with StringToSequence. SequenceToString panics
+// if seq is not a valid sequence number. Use LookupSequence if seq may not be
+// valid.
+func (i *SymbolTab64) SequenceToString(seq uint64) string {
+	return i.sb.Get(i.ib.lookup(seq))
+}
+
+// LookupSequence looks up a string by its sequence number. Unlike
+// SequenceToString it does not panic if seq is not valid. Valid sequence
+// numbers run from 1 to Len() inclusive.
+func (i *SymbolTab64) LookupSequence(seq uint64) (val string, ok bool) {
+	if seq == 0 || seq > i.maxSequence {
+		return "", false
+	}
+	return i.sb.Get(i.ib.lookup(seq)), true
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// SymbolTab64, in sequence order. Strings added during iteration may or may not
+// be included.
+func (i *SymbolTab64) All() iter.Seq2[uint64, string] {
+	return func(yield func(uint64, string) bool) {
+		for seq := uint64(1); seq <= i.maxSequence; seq++ {
+			if val, ok := i.LookupSequence(seq); ok {
+				if !yield(seq, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// StringToSequence looks up the string val and returns its sequence number seq. If val does
+// not currently exist in the symbol table, it will add it if addNew is true. found indicates
+// whether val was already present in the SymbolTab64
+//
+// If val can't be added, StringToSequence returns 0. Use Insert to find out
+// why.
+func (i *SymbolTab64) StringToSequence(val string, addNew bool) (seq uint64, found bool) {
+	seq, found, _ = i.stringToSequence(val, addNew)
+	return seq, found
+}
+
+// Insert looks up the string val and returns its sequence number seq, adding
+// val if it is not already present. found indicates whether val was already
+// present. If memory for val can't be allocated, Insert returns an error that
+// wraps ErrAlloc, and the SymbolTab64 is unchanged.
+func (i *SymbolTab64) Insert(val string) (seq uint64, found bool, err error) {
+	return i.stringToSequence(val, true)
+}
+
+func (i *SymbolTab64) stringToSequence(val string, addNew bool) (seq uint64, found bool, err error) {
+	if addNew && i.seed == 0 {
+		i.seed = newSeed()
+	}
+	hash := i.hash.sum64(val, i.seed)
+
+	if addNew {
+		if err := i.resize(); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if i.oldTable.len() != 0 {
+		if addNew {
+			i.resizeWork()
+		}
+		if _, sequence := i.findInTable(i.oldTable, val, hash); sequence != 0 {
+			return sequence, true, nil
+		}
+	}
+
+	cursor, sequence := i.findInTable(i.table, val, hash)
+	if sequence != 0 {
+		return sequence, true, nil
+	}
+
+	if !addNew {
+		return 0, false, nil
+	}
+
+	if err := i.ib.grow(i.maxSequence + 1); err != nil {
+		return 0, false, err
+	}
+	i.maxSequence++
+	sequence = i.maxSequence
+	i.count++
+	i.table.entries[cursor] = tableEntry64{
+		hash:     hash,
+		sequence: sequence,
+	}
+	i.ib.save(sequence, i.sb.Save(val))
+
+	return sequence, false, nil
+}
+
+// BytesToSequence is like StringToSequence, but takes a byte slice. It does not
+// allocate, and val is only copied if it is added to the table.
+func (i *SymbolTab64) BytesToSequence(val []byte, addNew bool) (seq uint64, found bool) {
+	return i.StringToSequence(unsafe.String(unsafe.SliceData(val), len(val)), addNew)
+}
+
+// findInTable finds the string val in the hash table. If the string is
+// present it returns where it was found and its sequence number. If not the
+// cursor is where the string should be added.
+func (i *SymbolTab64) findInTable(table table64, val string, hashVal uint64) (cursor int, sequence uint64) {
+	l := table.len()
+	if l == 0 {
+		return 0, 0
+	}
+	cursor = int(hashVal & uint64(l-1))
+	for {
+		e := table.entries[cursor]
+		if e.sequence == 0 {
+			return cursor, 0
+		}
+		if e.hash == hashVal && i.sb.Get(i.ib.lookup(e.sequence)) == val {
+			return cursor, e.sequence
+		}
+		// The table is never more than half full, so we will always find a
+		// space
+		cursor = (cursor + 1) & (l - 1)
+	}
+}
+
+func (i *SymbolTab64) copyEntryToTable(table table64, entry tableEntry64) {
+	l := table.len()
+	cursor := int(entry.hash & uint64(l-1))
+	for table.entries[cursor].sequence != 0 {
+		cursor = (cursor + 1) & (l - 1)
+	}
+	table.entries[cursor] = entry
+}
+
+func (i *SymbolTab64) resizeWork() {
+	// As with SymbolTab we copy 16 entries each time a string is added
+	l := i.oldTable.len()
+	if l == 0 {
+		return
+	}
+	for _, entry := range i.oldTable.entries[i.oldTableCursor : i.oldTableCursor+16] {
+		if entry.sequence != 0 {
+			i.copyEntryToTable(i.table, entry)
+		}
+	}
+	i.oldTableCursor += 16
+	if i.oldTableCursor >= l {
+		i.oldTable.close()
+		i.oldTableCursor = 0
+	}
+}
+
+func (i *SymbolTab64) resize() error {
+	if i.table.entries == nil {
+		// Makes zero value of SymbolTab64 useful
+		if err := i.table.init(16); err != nil {
+			return err
+		}
+	}
+
+	if i.count < i.table.len()/loadFactor || i.oldTable.entries != nil {
+		return nil
+	}
+
+	// Unlike SymbolTab we have all the bits we need to keep growing
+	var newTable table64
+	if err := newTable.init(i.table.len() * 2); err != nil {
+		return err
+	}
+	i.oldTable, i.table = i.table, newTable
+	return nil
+}
+
+// table64 is the hash table for SymbolTab64. Like table, each entry keeps the
+// hash and the sequence number together.
+type table64 struct {
+	entries []tableEntry64
+}
+
+type tableEntry64 struct {
+	hash     uint64
+	sequence uint64
+}
+
+func (t *table64) init(cap int) (err error) {
+	if t.entries, err = mmap.Alloc[tableEntry64](cap); err != nil {
+		return fmt.Errorf("%w: table of %d entries: %w", ErrAlloc, cap, err)
+	}
+	return nil
+}
+
+func (t table64) len() int {
+	return len(t.entries)
+}
+
+func (t *table64) close() {
+	if t.entries != nil {
+		mmap.Free(t.entries)
+		t.entries = nil
+	}
+}
+
+// intbank64 maps 64 bit sequence numbers to stringbank offsets. Slabs are
+// allocated when they are first written, so sequence numbers don't need to
+// start at 1.
+type intbank64 struct {
+	slabs [][]int
+}
+
+func (ib *intbank64) close() {
+	for _, s := range ib.slabs {
+		if s != nil {
+			mmap.Free(s)
+		}
+	}
+	ib.slabs = nil
+}
+
+// grow makes sure the intbank64 has space for sequence
+func (ib *intbank64) grow(sequence uint64) error {
+	slabNo := int((sequence - 1) / intbanksize)
+	for len(ib.slabs) <= slabNo {
+		ib.slabs = append(ib.slabs, nil)
+	}
+	if ib.slabs[slabNo] == nil {
+		s, err := mmap.Alloc[int](intbanksize)
+		if err != nil {
+			return fmt.Errorf("%w: intbank: %w", ErrAlloc, err)
+		}
+		ib.slabs[slabNo] = s
+	}
+	return nil
+}
+
+// save records the offset for sequence. As with intbank, it panics if there's
+// no space for sequence and grow fails.
+func (ib *intbank64) save(sequence uint64, offset int) {
+	if err := ib.grow(sequence); err != nil {
+		panic(err)
+	}
+	sequence-- // externally sequence starts at 1
+	slabNo := int(sequence / intbanksize)
+	slabOffset := int(sequence % intbanksize)
+
+	ib.slabs[slabNo][slabOffset] = offset
+}
+
+func (ib *intbank64) lookup(sequence uint64) int {
+	sequence-- // externally, sequence starts at 1
+	return ib.slabs[sequence/intbanksize][sequence%intbanksize]
+}
@@ -0,0 +1,176 @@
+package offheap
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymbolTab64(t *testing.T) {
+	st := New64(16)
+	defer st.Close()
+
+	for i := range 10000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint64(i+1), seq)
+	}
+	assert.Equal(t, 10000, st.Len())
+	assert.Equal(t, 32768, st.Cap())
+
+	for i := range 10000 {
+		seq, found := st.BytesToSequence([]byte(strconv.Itoa(i)), false)
+		assert.True(t, found)
+		assert.Equal(t, uint64(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(seq))
+	}
+
+	_, found := st.StringToSequence("missing", false)
+	assert.False(t, found)
+	_, ok := st.LookupSequence(0)
+	assert.False(t, ok)
+	_, ok = st.LookupSequence(10001)
+	assert.False(t, ok)
+
+	var next uint64
+	for seq, val := range st.All() {
+		next++
+		assert.Equal(t, next, seq)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+	assert.Equal(t, uint64(10000), next)
+}
+
+func TestSymbolTab64ZeroValue(t *testing.T) {
+	var st SymbolTab64
+	defer st.Close()
+
+	seq, found := st.StringToSequence("hat", false)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+
+	seq, found = st.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, "hat", st.SequenceToString(1))
+}
+
+// TestSymbolTab64Sequences starts the sequence numbers just short of where
+// SymbolTab runs out, so we can check we carry on past them.
+func TestSymbolTab64Sequences(t *testing.T) {
+	st := New64(16)
+	defer st.Close()
+	const start = math.MaxUint32 - 100
+	st.maxSequence = start
+
+	for i := range 1000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint64(start+i+1), seq)
+	}
+	for i := range 1000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint64(start+i+1), seq)
+		val, ok := st.LookupSequence(seq)
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(i), val)
+	}
+	_, ok := st.LookupSequence(math.MaxUint32 + 1000)
+	assert.False(t, ok)
+
+	// SymbolTab can't do this
+	st32 := New(16)
+	defer st32.Close()
+	st32.maxSequence = tombstone - 1
+	_, _, err := st32.Insert("a")
+	assert.True(t, errors.Is(err, ErrFull))
+}
+
+// TestSymbolTab64NarrowHash uses a hash with only 8 bits. The table grows to
+// many times the number of distinct hash values, which is the position SymbolTab
+// would be in with 32 bit hashes and more than 4 billion strings.
+func TestSymbolTab64NarrowHash(t *testing.T) {
+	narrow := HashCustom("narrow", func(b []byte) uint64 {
+		return uint64(fnv1a(string(b)) & 0xFF)
+	})
+	st := NewWithHash64(16, narrow)
+	defer st.Close()
+
+	for i := range 5000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint64(i+1), seq)
+	}
+	assert.True(t, st.Cap() > 256*16)
+	for i := range 5000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint64(i+1), seq)
+	}
+}
+
+// TestSymbolTab64WideHash uses a hash where the strings only differ above bit
+// 32. Truncated to 32 bits these would all be the same.
+func TestSymbolTab64WideHash(t *testing.T) {
+	wide := HashCustom("wide", func(b []byte) uint64 {
+		return uint64(fnv1a(string(b)))<<32 | 0x1234
+	})
+	st := NewWithHash64(16, wide)
+	defer st.Close()
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	hashes := make(map[uint64]struct{})
+	for _, e := range st.table.entries {
+		if e.sequence != 0 {
+			hashes[e.hash] = struct{}{}
+		}
+	}
+	assert.True(t, len(hashes) > 990)
+}
+
+func TestIntbank64(t *testing.T) {
+	var ib intbank64
+	defer ib.close()
+
+	seqs := []uint64{1, 4096, 4097, math.MaxUint32, math.MaxUint32 + 1, 1 << 33}
+	for j, seq := range seqs {
+		ib.save(seq, j)
+	}
+	for j, seq := range seqs {
+		assert.Equal(t, j, ib.lookup(seq))
+	}
+
+	// Only the slabs we've written to are allocated
+	var slabs int
+	for _, s := range ib.slabs {
+		if s != nil {
+			slabs++
+		}
+	}
+	assert.Equal(t, 4, slabs)
+}
+
+func BenchmarkSymbolTab64(b *testing.B) {
+	symbols := make([]string, b.N)
+	for i := range symbols {
+		symbols[i] = strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	st := New64(16)
+	defer st.Close()
+	for _, sym := range symbols {
+		st.StringToSequence(sym, true)
+	}
+
+	if symbols[0] != st.SequenceToString(1) {
+		b.Errorf("first symbol doesn't match - get %s", st.SequenceToString(1))
+	}
+}
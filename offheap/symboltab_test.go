@@ -2,6 +2,7 @@ package offheap
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"strconv"
 	"testing"
@@ -93,6 +94,99 @@ func TestAddNew(t *testing.T) {
 	assert.Equal(t, uint32(1), seq)
 }
 
+func TestBytesToSequence(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	val := []byte("hat")
+
+	seq, found := st.BytesToSequence(val, false)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+
+	seq, found = st.BytesToSequence(val, true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	// The table should have taken a copy
+	val[0] = 'c'
+	assert.Equal(t, "hat", st.SequenceToString(1))
+
+	seq, found = st.BytesToSequence([]byte("hat"), false)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	// Bytes and strings should find the same entries
+	seq, found = st.StringToSequence("cat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(2), seq)
+	seq, found = st.BytesToSequence(val, true)
+	assert.True(t, found)
+	assert.Equal(t, uint32(2), seq)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		st.BytesToSequence(val, false)
+		st.BytesToSequence(val, true)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestLookupSequence(t *testing.T) {
+	var st SymbolTab
+	defer st.Close()
+
+	for _, seq := range []uint32{0, 1, math.MaxUint32} {
+		val, ok := st.LookupSequence(seq)
+		assert.False(t, ok)
+		assert.Empty(t, val)
+	}
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	for _, seq := range []uint32{0, 1001, intbanksize * 4, math.MaxUint32} {
+		val, ok := st.LookupSequence(seq)
+		assert.False(t, ok)
+		assert.Empty(t, val)
+	}
+	for _, seq := range []uint32{1, 37, 1000} {
+		val, ok := st.LookupSequence(seq)
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+}
+
+func TestAll(t *testing.T) {
+	st := New(16)
+	defer st.Close()
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	var expSeq uint32
+	for seq, val := range st.All() {
+		expSeq++
+		assert.Equal(t, expSeq, seq)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+	assert.Equal(t, uint32(1000), expSeq)
+
+	var count int
+	for val := range st.Strings() {
+		assert.Equal(t, strconv.Itoa(count), val)
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count)
+
+	var empty SymbolTab
+	for range empty.All() {
+		t.Fatal("empty table should have no entries")
+	}
+}
+
 func TestLowGC(t *testing.T) {
 	st := New(16)
 	defer st.Close()
@@ -231,6 +325,18 @@ func ExampleSymbolTab() {
 	// 10293-ahdb-28383-555
 }
 
+func ExampleSymbolTab_All() {
+	st := SymbolTab{}
+	defer st.Close()
+	st.StringToSequence("cheese", true)
+	st.StringToSequence("hat", true)
+	for seq, val := range st.All() {
+		fmt.Println(seq, val)
+	}
+	// Output: 1 cheese
+	// 2 hat
+}
+
 func BenchmarkMakeBigSlice(b *testing.B) {
 	b.ReportAllocs()
 	for b.Loop() {
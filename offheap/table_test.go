@@ -0,0 +1,76 @@
+package offheap_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/philpearl/symboltab"
+	"github.com/philpearl/symboltab/offheap"
+	"github.com/philpearl/symboltab/tabletest"
+)
+
+var (
+	_ symboltab.Table = (*offheap.SymbolTab)(nil)
+	_ symboltab.Table = (*offheap.FileSymbolTab)(nil)
+)
+
+func TestTable(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		st := offheap.New(16)
+		t.Cleanup(st.Close)
+		return st
+	})
+}
+
+func TestTableHash(t *testing.T) {
+	for _, hash := range []offheap.Hash{
+		offheap.HashMaphash,
+		offheap.HashXXH3,
+		offheap.HashWyhash,
+		offheap.HashCustom("java", func(b []byte) uint64 {
+			var h uint64
+			for _, c := range b {
+				h = h*31 + uint64(c)
+			}
+			return h
+		}),
+	} {
+		t.Run(hash.String(), func(t *testing.T) {
+			tabletest.Run(t, func(t *testing.T) symboltab.Table {
+				st := offheap.NewWithHash(16, hash)
+				t.Cleanup(st.Close)
+				return st
+			})
+		})
+	}
+}
+
+func TestTableSwiss(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		st, err := offheap.NewWithOptions(offheap.WithLayout(offheap.LayoutSwiss))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(st.Close)
+		return st
+	})
+}
+
+func TestTableZero(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		st := &offheap.SymbolTab{}
+		t.Cleanup(st.Close)
+		return st
+	})
+}
+
+func TestFileTable(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		st, err := offheap.OpenWritable(filepath.Join(t.TempDir(), "symbols"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+		return st
+	})
+}
@@ -0,0 +1,261 @@
+package symboltab
+
+import (
+	"iter"
+	"math/bits"
+	"slices"
+	"unsafe"
+)
+
+// PerfectSymbolTab is a read-only symbol table for a fixed set of strings. It
+// is built with NewPerfect, and finds strings with a minimal perfect hash
+// function, so it needs no spare table space. It is safe for concurrent use.
+//
+// The hash function is built with the "hash, displace and compress" approach.
+// Strings are first hashed into buckets, with about two strings per bucket.
+// For each bucket we store a seed that sends all of its strings to different
+// slots in a table with exactly one slot per string. Buckets with one string
+// store the slot directly. Each slot also has a byte of the string's hash, so
+// most lookups for strings that aren't present stop before reading a string.
+type PerfectSymbolTab struct {
+	// seeds has an entry per bucket. A positive entry is the hash seed for the
+	// strings in the bucket. A negative entry s means the bucket's single string
+	// is in slot -s-1. Zero means the bucket is empty.
+	seeds []int32
+	// slots holds the sequence number of the string in each slot
+	slots []uint32
+	// fingerprints holds a byte of the hash of the string in each slot. This
+	// lets us reject most strings that aren't present without looking at the
+	// strings themselves.
+	fingerprints []uint8
+	// The string for sequence number seq is data[offsets[seq-1]:offsets[seq]]
+	offsets []uint64
+	data    []byte
+}
+
+// NewPerfect builds a PerfectSymbolTab containing vals. Sequence numbers are
+// allocated as if each string in vals was added in turn with StringToSequence,
+// so they run from 1 in the order the strings first appear in vals.
+//
+// Building the table takes a little longer than adding the same strings to a
+// SymbolTab, but the result uses less memory and lookups are faster.
+func NewPerfect(vals []string) *PerfectSymbolTab {
+	// Remove duplicates, keeping the first of each
+	seen := make(map[string]struct{}, len(vals))
+	unique := make([]string, 0, len(vals))
+	var size int
+	for _, val := range vals {
+		if _, ok := seen[val]; !ok {
+			seen[val] = struct{}{}
+			unique = append(unique, val)
+			size += len(val)
+		}
+	}
+	seen = nil
+	n := len(unique)
+
+	p := &PerfectSymbolTab{
+		offsets:      make([]uint64, n+1),
+		slots:        make([]uint32, n),
+		fingerprints: make([]uint8, n),
+		data:         make([]byte, 0, size),
+	}
+	for j, val := range unique {
+		p.data = append(p.data, val...)
+		p.offsets[j+1] = uint64(len(p.data))
+	}
+	if n == 0 {
+		return p
+	}
+
+	// Sort the sequence numbers into buckets with a counting sort
+	p.seeds = make([]int32, max(1, n/2))
+	starts := make([]int, len(p.seeds)+1)
+	for _, val := range unique {
+		starts[reduce(seededHash(val, 0), len(p.seeds))+1]++
+	}
+	for b := range p.seeds {
+		starts[b+1] += starts[b]
+	}
+	next := slices.Clone(starts)
+	members := make([]uint32, n)
+	for j, val := range unique {
+		b := reduce(seededHash(val, 0), len(p.seeds))
+		members[next[b]] = uint32(j + 1)
+		next[b]++
+	}
+
+	// Place the biggest buckets first, while there are plenty of free slots
+	order := make([]int, len(p.seeds))
+	for b := range order {
+		order[b] = b
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return (starts[b+1] - starts[b]) - (starts[a+1] - starts[a])
+	})
+
+	taken := newBitset(uint64(n))
+	var trial []int
+	for _, b := range order {
+		bucket := members[starts[b]:starts[b+1]]
+		if len(bucket) <= 1 {
+			break
+		}
+	seeds:
+		for seed := int32(1); ; seed++ {
+			if seed < 0 {
+				panic("could not build perfect hash!")
+			}
+			trial = trial[:0]
+			for _, seq := range bucket {
+				slot := reduce(seededHash(p.SequenceToString(seq), uintptr(seed)), n)
+				if taken.has(uint64(slot)) || slices.Contains(trial, slot) {
+					continue seeds
+				}
+				trial = append(trial, slot)
+			}
+			for j, slot := range trial {
+				taken.set(uint64(slot))
+				p.setSlot(slot, bucket[j])
+			}
+			p.seeds[b] = seed
+			break
+		}
+	}
+
+	// The remaining buckets have at most one string, so we can just put each
+	// in a free slot
+	var slot int
+	for _, b := range order {
+		bucket := members[starts[b]:starts[b+1]]
+		if len(bucket) == 0 {
+			break
+		}
+		if len(bucket) > 1 {
+			continue
+		}
+		for taken.has(uint64(slot)) {
+			slot++
+		}
+		taken.set(uint64(slot))
+		p.setSlot(slot, bucket[0])
+		p.seeds[b] = int32(-slot - 1)
+	}
+
+	return p
+}
+
+func (p *PerfectSymbolTab) setSlot(slot int, seq uint32) {
+	p.slots[slot] = seq
+	p.fingerprints[slot] = fingerprint(seededHash(p.SequenceToString(seq), 0))
+}
+
+// fingerprint picks a byte of hash. reduce uses the top bits of the hash to
+// choose the bucket, so we use bits from the middle.
+func fingerprint(hash uint64) uint8 {
+	return uint8(hash >> 32)
+}
+
+// Len returns the number of unique strings stored
+func (p *PerfectSymbolTab) Len() int {
+	return len(p.slots)
+}
+
+// Size returns the approximate number of bytes of memory used by the
+// PerfectSymbolTab
+func (p *PerfectSymbolTab) Size() int {
+	return len(p.seeds)*4 + len(p.slots)*5 + len(p.offsets)*8 + len(p.data)
+}
+
+// StringToSequence looks up the string val and returns its sequence number
+// seq. found indicates whether val is present. The set of strings is fixed, so
+// addNew is ignored. If val is not present StringToSequence returns 0, false.
+func (p *PerfectSymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
+	return p.find(val)
+}
+
+// BytesToSequence is like StringToSequence, but takes a byte slice. It does not
+// allocate.
+func (p *PerfectSymbolTab) BytesToSequence(val []byte, addNew bool) (seq uint32, found bool) {
+	return p.StringToSequence(unsafe.String(unsafe.SliceData(val), len(val)), addNew)
+}
+
+func (p *PerfectSymbolTab) find(val string) (seq uint32, found bool) {
+	n := len(p.slots)
+	if n == 0 {
+		return 0, false
+	}
+	hash := seededHash(val, 0)
+	var slot int
+	switch seed := p.seeds[reduce(hash, len(p.seeds))]; {
+	case seed > 0:
+		slot = reduce(seededHash(val, uintptr(seed)), n)
+	case seed < 0:
+		slot = int(-seed - 1)
+	default:
+		return 0, false
+	}
+	// Strings that aren't in the set are sent to some slot, so we must check
+	// the string matches
+	if p.fingerprints[slot] != fingerprint(hash) {
+		return 0, false
+	}
+	seq = p.slots[slot]
+	if p.SequenceToString(seq) != val {
+		return 0, false
+	}
+	return seq, true
+}
+
+// SequenceToString looks up a string by its sequence number. It panics if seq
+// is not valid. Use LookupSequence if seq may not be valid.
+func (p *PerfectSymbolTab) SequenceToString(seq uint32) string {
+	b := p.data[p.offsets[seq-1]:p.offsets[seq]]
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// LookupSequence looks up a string by its sequence number. If seq is 0 or out
+// of range, ok is false.
+func (p *PerfectSymbolTab) LookupSequence(seq uint32) (val string, ok bool) {
+	if seq == 0 || int(seq) > len(p.slots) {
+		return "", false
+	}
+	return p.SequenceToString(seq), true
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// PerfectSymbolTab, in sequence order
+func (p *PerfectSymbolTab) All() iter.Seq2[uint32, string] {
+	return func(yield func(uint32, string) bool) {
+		for seq := uint32(1); int(seq) <= len(p.slots); seq++ {
+			if !yield(seq, p.SequenceToString(seq)) {
+				return
+			}
+		}
+	}
+}
+
+// Strings returns an iterator over the strings in the PerfectSymbolTab, in
+// sequence order
+func (p *PerfectSymbolTab) Strings() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, val := range p.All() {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+// seededHash hashes val with the runtime hash function and the given seed. On
+// 32 bit platforms the hash is in the top bits, which is where reduce wants it.
+func seededHash(val string, seed uintptr) uint64 {
+	h := memhash(unsafe.Pointer(unsafe.StringData(val)), seed, uintptr(len(val)))
+	return uint64(h) << (64 - bits.UintSize)
+}
+
+// reduce maps hash onto the range [0, n) without a division
+func reduce(hash uint64, n int) int {
+	hi, _ := bits.Mul64(hash, uint64(n))
+	return int(hi)
+}
@@ -0,0 +1,148 @@
+package symboltab
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerfect(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 10, 1000, 100_000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			vals := make([]string, n)
+			for i := range vals {
+				vals[i] = strconv.Itoa(i)
+			}
+			p := NewPerfect(vals)
+			assert.Equal(t, n, p.Len())
+
+			for i, val := range vals {
+				seq, found := p.StringToSequence(val, false)
+				if !assert.True(t, found, val) {
+					break
+				}
+				assert.Equal(t, uint32(i+1), seq)
+				assert.Equal(t, val, p.SequenceToString(seq))
+
+				seq, found = p.BytesToSequence([]byte(val), false)
+				assert.True(t, found)
+				assert.Equal(t, uint32(i+1), seq)
+			}
+
+			for i := range 1000 {
+				_, found := p.StringToSequence(strconv.Itoa(-1-i), false)
+				assert.False(t, found)
+			}
+
+			_, ok := p.LookupSequence(0)
+			assert.False(t, ok)
+			_, ok = p.LookupSequence(uint32(n + 1))
+			assert.False(t, ok)
+
+			var count int
+			for seq, val := range p.All() {
+				assert.Equal(t, vals[seq-1], val)
+				count++
+			}
+			assert.Equal(t, n, count)
+		})
+	}
+}
+
+func TestPerfectDuplicates(t *testing.T) {
+	p := NewPerfect([]string{"a", "b", "a", "", "c", "b"})
+	assert.Equal(t, 4, p.Len())
+	for seq, val := range map[uint32]string{1: "a", 2: "b", 3: "", 4: "c"} {
+		assert.Equal(t, val, p.SequenceToString(seq))
+		seq2, found := p.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, seq, seq2)
+	}
+}
+
+func TestPerfectAddNew(t *testing.T) {
+	p := NewPerfect([]string{"a", "b"})
+	seq, found := p.StringToSequence("a", true)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+	seq, found = p.StringToSequence("c", true)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+	assert.Equal(t, 2, p.Len())
+}
+
+// BenchmarkStatic compares the memory use and lookup speed of the different
+// tables for a fixed set of strings
+func BenchmarkStatic(b *testing.B) {
+	const n = 1_000_000
+	vals := make([]string, n)
+	for i := range vals {
+		vals[i] = "gene-" + strconv.Itoa(i)
+	}
+	misses := make([]string, n)
+	for i := range misses {
+		misses[i] = "gene-" + strconv.Itoa(n+i)
+	}
+
+	tables := []struct {
+		name  string
+		build func() Table
+	}{
+		{"SymbolTab", func() Table {
+			st := New(n)
+			for _, val := range vals {
+				st.StringToSequence(val, true)
+			}
+			return st
+		}},
+		{"Naive", func() Table {
+			st := NewNaive(n)
+			for _, val := range vals {
+				st.StringToSequence(val, true)
+			}
+			return st
+		}},
+		{"Perfect", func() Table {
+			return NewPerfect(vals)
+		}},
+	}
+
+	for _, table := range tables {
+		// Measure the heap used by the table, not counting the strings we
+		// built it from. Naive keeps references to them so we count their bytes
+		// as well to be fair.
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		st := table.build()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+		if table.name == "Naive" {
+			for _, val := range vals {
+				heap += int64(len(val))
+			}
+		}
+
+		b.Run(table.name+"/Existing", func(b *testing.B) {
+			b.ReportMetric(float64(heap)/n, "heap-bytes/string")
+			b.ReportAllocs()
+			for i := range b.N {
+				if _, found := st.StringToSequence(vals[i%n], false); !found {
+					b.Fatal("not found")
+				}
+			}
+		})
+		b.Run(table.name+"/Miss", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := range b.N {
+				if _, found := st.StringToSequence(misses[i%n], false); found {
+					b.Fatal("found")
+				}
+			}
+		})
+		runtime.KeepAlive(st)
+	}
+}
@@ -0,0 +1,56 @@
+package symboltab
+
+import "sync/atomic"
+
+// defaultProbeLimit is the number of entries a lookup can step over before we
+// consider it pathological. With our load factor a lookup almost always finds
+// what it is looking for within a handful of entries, and even in tables with
+// hundreds of millions of strings the longest runs are well under this.
+const defaultProbeLimit = 128
+
+// SetProbeLimit sets the number of entries a lookup can step over in the
+// hash table before the lookup is reported as a long probe. Long probes
+// suggest that someone has found a set of strings that collide, so lookups
+// are degrading towards a linear scan. If limit is 0 the default is used. With
+// LayoutSwiss lookups step over whole groups of 8 entries at a time, and all
+// the entries in a group count towards the limit.
+//
+// If fn is not nil it is called with the length of each long probe. As lookups
+// may run concurrently with each other, fn may be called concurrently too.
+// Long probes are counted whether or not fn is set. See LongProbes.
+func (i *Tab[S]) SetProbeLimit(limit int, fn func(probes int)) {
+	i.probeLimit = limit
+	i.onLongProbe = fn
+}
+
+// LongProbes returns the number of lookups that have exceeded the probe limit,
+// and the length of the longest of them.
+func (i *Tab[S]) LongProbes() (count, longest int) {
+	return int(atomic.LoadUint32(&i.longProbes)), int(atomic.LoadUint32(&i.longestProbe))
+}
+
+// checkProbes reports the lookup if probes is over the limit
+func (i *Tab[S]) checkProbes(probes int) {
+	limit := i.probeLimit
+	if limit == 0 {
+		limit = defaultProbeLimit
+	}
+	if probes > limit {
+		i.longProbe(probes)
+	}
+}
+
+// longProbe records a long probe. Lookups can happen concurrently under a read
+// lock, so we update the counts atomically.
+func (i *Tab[S]) longProbe(probes int) {
+	atomic.AddUint32(&i.longProbes, 1)
+	for {
+		longest := atomic.LoadUint32(&i.longestProbe)
+		if uint32(probes) <= longest || atomic.CompareAndSwapUint32(&i.longestProbe, longest, uint32(probes)) {
+			break
+		}
+	}
+	if i.onLongProbe != nil {
+		i.onLongProbe(probes)
+	}
+}
@@ -0,0 +1,46 @@
+package symboltab
+
+// Renumber gives the live strings in the SymbolTab new sequence numbers that run
+// from 1 to Len() with no gaps, keeping them in the same order. It returns a
+// slice that maps old sequence numbers to new ones, so callers can rewrite any
+// data that refers to the old sequence numbers. The slice has an entry for every
+// old sequence number. Entries for deleted sequence numbers are 0.
+//
+// Renumber copies the live strings into fresh storage, so it also reclaims the
+// space used by deleted strings.
+func (i *Tab[S]) Renumber() []S {
+	// Finish any resize so every entry is in the current table
+	for i.oldTable.len() != 0 {
+		i.resizeWork()
+	}
+
+	n := &Tab[S]{
+		table:  newTable[S](i.tuning.tableLen(i.count), i.tuning.layout),
+		tuning: i.tuning,
+	}
+	n.recycle = i.recycle
+	n.hash = i.hash
+	n.seed = i.seed
+	n.probeLimit = i.probeLimit
+	n.onLongProbe = i.onLongProbe
+	mapping := make([]S, i.maxSequence+1)
+	for seq := S(1); seq <= i.maxSequence; seq++ {
+		if offset := i.ib.lookup(seq); offset >= 0 {
+			n.maxSequence++
+			n.ib.save(n.maxSequence, n.sb.Save(i.sb.Get(offset)))
+			mapping[seq] = n.maxSequence
+		}
+	}
+	n.count = int(n.maxSequence)
+
+	// The hashes don't change, so we can build the new table from the old one
+	// without rehashing any strings
+	for _, entry := range i.table.entries {
+		if entry.live() {
+			n.copyEntryToTable(n.table, entry.hash, mapping[entry.sequence])
+		}
+	}
+
+	*i = *n
+	return mapping
+}
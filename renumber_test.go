@@ -0,0 +1,62 @@
+package symboltab
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenumber(t *testing.T) {
+	st := New(16)
+	// 8,500 entries leaves the table part way through a resize
+	const n = 8_500
+	for i := range n {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+	for i := 0; i < n; i += 3 {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	live := st.Len()
+
+	mapping := st.Renumber()
+	require.Len(t, mapping, n+1)
+	assert.Equal(t, live, st.Len())
+	assert.Zero(t, st.oldTable.len())
+
+	var next uint32
+	for i := range n {
+		val := strconv.Itoa(i)
+		newSeq := mapping[i+1]
+		if i%3 == 0 {
+			assert.Zero(t, newSeq)
+			_, found := st.StringToSequence(val, false)
+			assert.False(t, found)
+			continue
+		}
+		// Sequence numbers are dense and in the same order as before
+		next++
+		assert.Equal(t, next, newSeq)
+		seq, found := st.StringToSequence(val, false)
+		assert.True(t, found)
+		assert.Equal(t, newSeq, seq)
+		assert.Equal(t, val, st.SequenceToString(seq))
+	}
+	assert.Equal(t, uint32(live), next)
+	_, ok := st.LookupSequence(uint32(live + 1))
+	assert.False(t, ok)
+
+	// New strings follow on from the renumbered ones
+	seq, found := st.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(live+1), seq)
+}
+
+func TestRenumberEmpty(t *testing.T) {
+	var st SymbolTab
+	assert.Equal(t, []uint32{0}, st.Renumber())
+	seq, _ := st.StringToSequence("a", true)
+	assert.Equal(t, uint32(1), seq)
+}
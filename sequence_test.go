@@ -0,0 +1,98 @@
+package symboltab
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type wordID uint16
+
+func TestTabUint16Full(t *testing.T) {
+	st := NewTab[wordID](0)
+	for i := range math.MaxUint16 - 1 {
+		seq, found, err := st.Insert(strconv.Itoa(i))
+		require.NoError(t, err)
+		assert.False(t, found)
+		assert.Equal(t, wordID(i+1), seq)
+	}
+	assert.Equal(t, math.MaxUint16-1, st.Len())
+
+	// We're out of sequence numbers
+	_, _, err := st.Insert("one more")
+	assert.True(t, errors.Is(err, ErrFull))
+	seq, found := st.StringToSequence("one more", true)
+	assert.Zero(t, seq)
+	assert.False(t, found)
+	assert.Equal(t, math.MaxUint16-1, st.Len())
+
+	// Existing strings are still found
+	seq, found, err = st.Insert("1000")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, wordID(1001), seq)
+	for i := range math.MaxUint16 - 1 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(seq))
+	}
+
+	// If we delete a string and recycle its sequence number we have space again
+	st.RecycleSequences(true)
+	assert.True(t, st.Delete("1000"))
+	seq, found, err = st.Insert("one more")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, wordID(1001), seq)
+}
+
+func TestTabUint64(t *testing.T) {
+	st := NewTab[uint64](0)
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint64(i+1), seq)
+	}
+	assert.True(t, st.Delete("37"))
+
+	var buf bytes.Buffer
+	_, err := st.WriteTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	var st2 Tab[uint64]
+	_, err = st2.ReadFrom(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, st.Len(), st2.Len())
+	for i := range 10_000 {
+		seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+		assert.Equal(t, i != 37, found)
+		if found {
+			assert.Equal(t, uint64(i+1), seq)
+		}
+	}
+
+	// A table with different sized sequence numbers can't read it
+	var st3 SymbolTab
+	_, err = st3.ReadFrom(bytes.NewReader(data))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	f := st.Freeze()
+	seq, found := f.StringToSequence("9999")
+	assert.True(t, found)
+	assert.Equal(t, uint64(10000), seq)
+	_, ok := f.LookupSequence(38)
+	assert.False(t, ok)
+}
+
+func TestTabEntrySize(t *testing.T) {
+	assert.Equal(t, 8, int(unsafe.Sizeof(tableEntry[uint16]{})))
+	assert.Equal(t, 8, int(unsafe.Sizeof(tableEntry[uint32]{})))
+	assert.Equal(t, 16, int(unsafe.Sizeof(tableEntry[uint64]{})))
+}
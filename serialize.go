@@ -0,0 +1,479 @@
+package symboltab
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// The serialized form of a SymbolTab is as follows. All integers are little-endian.
+//
+//	magic          [4]byte "SYMT"
+//	version        uint32
+//	hash           uint32 the hash function used for the table
+//	hash name len  uint32
+//	fingerprint    uint64 hashes of fixed strings with the hash function
+//	count          uint64
+//	maxSequence    uint64
+//	freeList       uint64
+//	tombstones     uint64
+//	table len      uint64
+//	oldTable len   uint64
+//	oldTableCursor uint64
+//	seed           uint64 the table's hash seed
+//	sequence size  uint64 the size of a sequence number in bytes
+//	layout         uint64 the Layout of the hash table
+//	strings len    uint64 the number of bytes of strings
+//	header sum     uint32 CRC-32C of the header fields above
+//	hash name      [hash name len]byte
+//	table entries  (hash uint32, sequence) * table len
+//	oldTable       (hash uint32, sequence) * oldTable len
+//	strings        string * maxSequence, in sequence order
+//	checksum       uint32 CRC-32C of everything above
+//
+// Each string is written as a uvarint of its length + 1 followed by its bytes.
+// Deleted sequence numbers are written as a uvarint 0 followed by a uvarint of
+// the next sequence number in the free list.
+//
+// The header has its own checksum so that ReadFrom can check the lengths in it
+// before allocating anything. With the lengths from the header ReadFrom knows
+// exactly how much data there is, and never reads past the final checksum.
+//
+// Sequence numbers in the table entries take 2, 4 or 8 bytes, depending on the
+// type of sequence number the Tab uses. A table must be read back into a Tab
+// with the same type. The hash table entries are written as-is, so reading a table back does not
+// need to rehash any strings. The strings are written in sequence order and
+// saved back into the stringbank in the same order, which rebuilds the
+// intbank offsets.
+//
+// A table must be read back with the same hash function that it was written
+// with. Some hash functions, such as the runtime's, are seeded randomly in each
+// process, so the hash table is only reused if the fingerprint matches the
+// reading process. If not the table is rebuilt from the strings with a new
+// seed. The table is also rebuilt if it was written with a different Layout to
+// the one the reading SymbolTab uses.
+const (
+	serialMagic      = "SYMT"
+	serialVersion    = 7
+	serialHeaderSize = 112
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrInvalidFormat is returned by ReadFrom if the data is not a serialized
+	// SymbolTab, or is a version we don't understand
+	ErrInvalidFormat = errors.New("symboltab: invalid serialized format")
+	// ErrChecksum is returned by ReadFrom if the data is corrupt
+	ErrChecksum = errors.New("symboltab: checksum mismatch")
+)
+
+// WriteTo writes the SymbolTab to w in a binary format that can be read back
+// with ReadFrom. It implements io.WriterTo
+//
+// The hash table is written as it is, so that ReadFrom can use it without
+// rehashing the strings. But that only works if the hash values are the same
+// in the reading process. HashRuntime, the default, and HashMaphash give
+// different values in every process, so tables using them are rehashed when
+// they are read by another process. For tables that are saved and reloaded
+// after a restart, create them with NewWithHash and HashXXH3 or HashWyhash.
+func (i *Tab[S]) WriteTo(w io.Writer) (n int64, err error) {
+	cw := &countingWriter{w: w}
+	crc := crc32.New(castagnoli)
+	bw := bufio.NewWriter(io.MultiWriter(cw, crc))
+
+	buf := make([]byte, 0, serialHeaderSize)
+	buf = append(buf, serialMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, serialVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, i.hash.id)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(i.hash.String())))
+	buf = binary.LittleEndian.AppendUint64(buf, i.hashFingerprint())
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.count))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.maxSequence))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.freeList))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.tombstones))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.table.len()))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.oldTable.len()))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.oldTableCursor))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.seed))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(unsafe.Sizeof(S(0))))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(i.tuning.layout))
+	var stringsLen int
+	var prefix [2 * binary.MaxVarintLen64]byte
+	for seq := S(1); seq <= i.maxSequence; seq++ {
+		p, val := i.appendStringPrefix(prefix[:0], seq)
+		stringsLen += len(p) + len(val)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(stringsLen))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	buf = append(buf, i.hash.String()...)
+	if _, err := bw.Write(buf); err != nil {
+		return cw.n, err
+	}
+
+	for _, t := range []table[S]{i.table, i.oldTable} {
+		for _, e := range t.entries {
+			buf = binary.LittleEndian.AppendUint32(buf[:0], e.hash)
+			buf = appendSequence(buf, e.sequence)
+			if _, err := bw.Write(buf); err != nil {
+				return cw.n, err
+			}
+		}
+	}
+
+	for seq := S(1); seq <= i.maxSequence; seq++ {
+		var val string
+		buf, val = i.appendStringPrefix(buf[:0], seq)
+		if _, err := bw.Write(buf); err != nil {
+			return cw.n, err
+		}
+		if _, err := bw.WriteString(val); err != nil {
+			return cw.n, err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf[:0], crc.Sum32())
+	_, err = cw.Write(buf)
+	return cw.n, err
+}
+
+// ReadFrom replaces the contents of the SymbolTab with a table previously
+// written with WriteTo. It implements io.ReaderFrom. If an error is returned
+// the SymbolTab is left unchanged.
+//
+// The SymbolTab must be using the same hash function as the one that was
+// written, otherwise ReadFrom returns ErrHashMismatch.
+//
+// If the hash values in this process differ from those in the process that
+// wrote the table, ReadFrom rebuilds the hash table, hashing every string.
+// This always happens for HashRuntime and HashMaphash tables written by
+// another process, so after a restart reading them takes time proportional
+// to the size of the strings. HashXXH3 and HashWyhash give the same values in
+// every process, so their tables are used as they are. See WriteTo.
+func (i *Tab[S]) ReadFrom(r io.Reader) (n int64, err error) {
+	// The header is read straight from r, as we don't know how much data
+	// follows it until we've checked it
+	var header [serialHeaderSize + 4]byte
+	m, err := io.ReadFull(r, header[:])
+	n += int64(m)
+	if err != nil {
+		return n, unexpectedEOF(err)
+	}
+	if string(header[:4]) != serialMagic {
+		return n, fmt.Errorf("%w: bad magic number", ErrInvalidFormat)
+	}
+	if v := binary.LittleEndian.Uint32(header[4:]); v != serialVersion {
+		return n, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, v)
+	}
+	if binary.LittleEndian.Uint32(header[serialHeaderSize:]) != crc32.Checksum(header[:serialHeaderSize], castagnoli) {
+		return n, ErrChecksum
+	}
+	hashID := binary.LittleEndian.Uint32(header[8:])
+	hashNameLen := binary.LittleEndian.Uint32(header[12:])
+	fingerprint := binary.LittleEndian.Uint64(header[16:])
+	count := binary.LittleEndian.Uint64(header[24:])
+	maxSequence := binary.LittleEndian.Uint64(header[32:])
+	freeList := binary.LittleEndian.Uint64(header[40:])
+	tombstones := binary.LittleEndian.Uint64(header[48:])
+	tableLen := binary.LittleEndian.Uint64(header[56:])
+	oldTableLen := binary.LittleEndian.Uint64(header[64:])
+	oldTableCursor := binary.LittleEndian.Uint64(header[72:])
+	seed := binary.LittleEndian.Uint64(header[80:])
+	if size := binary.LittleEndian.Uint64(header[88:]); size != uint64(unsafe.Sizeof(S(0))) {
+		return n, fmt.Errorf("%w: %d byte sequence numbers, table uses %d", ErrInvalidFormat, size, unsafe.Sizeof(S(0)))
+	}
+	layout := binary.LittleEndian.Uint64(header[96:])
+	stringsLen := binary.LittleEndian.Uint64(header[104:])
+
+	if maxSequence >= uint64(tombstone[S]()) ||
+		count > maxSequence ||
+		freeList > maxSequence ||
+		(tableLen != 0 && !validTableLen(tableLen)) ||
+		(oldTableLen != 0 && !validTableLen(oldTableLen)) ||
+		oldTableLen > tableLen ||
+		(oldTableLen != 0 && oldTableCursor >= oldTableLen) ||
+		(oldTableLen == 0 && oldTableCursor != 0) ||
+		count+tombstones > tableLen ||
+		layout > uint64(LayoutSwiss) ||
+		hashNameLen > 1024 ||
+		// Each string takes at least a byte
+		stringsLen < maxSequence ||
+		stringsLen > math.MaxInt64/2 {
+		return n, fmt.Errorf("%w: inconsistent header", ErrInvalidFormat)
+	}
+	entrySize := 4 + uint64(unsafe.Sizeof(S(0)))
+	remaining := uint64(hashNameLen) + (tableLen+oldTableLen)*entrySize + stringsLen + 4
+
+	// We only buffer if r can't give us a byte at a time itself, and then
+	// only the data that belongs to the table.
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(io.LimitReader(r, int64(remaining)))
+	}
+	cr := &checksumReader{r: br, crc: crc32.New(castagnoli), n: &n}
+	cr.crc.Write(header[:])
+
+	hashName := make([]byte, hashNameLen)
+	if _, err := io.ReadFull(cr, hashName); err != nil {
+		return n, unexpectedEOF(err)
+	}
+	if !i.hash.equal(Hash{id: hashID, name: string(hashName)}) {
+		return n, fmt.Errorf("%w: table uses %s, data uses %s", ErrHashMismatch, i.hash, hashName)
+	}
+
+	st := Tab[S]{
+		hash:        i.hash,
+		recycle:     i.recycle,
+		tuning:      i.tuning,
+		probeLimit:  i.probeLimit,
+		onLongProbe: i.onLongProbe,
+		seed:        uintptr(seed),
+	}
+	sameHash := fingerprint == st.hashFingerprint()
+	keep := sameHash && Layout(layout) == st.tuning.layout
+	st.count = int(count)
+	st.maxSequence = S(maxSequence)
+	st.freeList = S(freeList)
+	st.tombstones = int(tombstones)
+	st.oldTableCursor = int(oldTableCursor)
+	// A table can be much larger than its strings need, if it was created
+	// with a large capacity or strings have been deleted, so a large table
+	// len isn't necessarily wrong. But we only trust the header so far, and
+	// allocate the rest of the table as its entries arrive.
+	prealloc := st.tuning.tableLen(int(count+tombstones)) * st.tuning.growthFactor()
+	if st.table, err = readTable[S](cr, int(tableLen), maxSequence, keep, st.tuning.layout, prealloc); err != nil {
+		return n, err
+	}
+	if st.oldTable, err = readTable[S](cr, int(oldTableLen), maxSequence, keep, st.tuning.layout, prealloc); err != nil {
+		return n, err
+	}
+	stringsStart := n
+
+	var buf []byte
+	var deleted uint64
+	for seq := S(1); seq <= S(maxSequence); seq++ {
+		l, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		if l == 0 {
+			next, err := binary.ReadUvarint(cr)
+			if err != nil {
+				return n, unexpectedEOF(err)
+			}
+			if next > maxSequence {
+				return n, fmt.Errorf("%w: free list entry %d out of range", ErrInvalidFormat, next)
+			}
+			st.ib.delete(seq, S(next))
+			deleted++
+			continue
+		}
+		l--
+		if l > math.MaxInt32 {
+			return n, fmt.Errorf("%w: string too long", ErrInvalidFormat)
+		}
+		if cap(buf) < int(l) {
+			buf = make([]byte, l)
+		}
+		buf = buf[:l]
+		if _, err := io.ReadFull(cr, buf); err != nil {
+			return n, unexpectedEOF(err)
+		}
+		// Save copies the string, so we don't need to allocate one here
+		offset := st.sb.Save(unsafe.String(unsafe.SliceData(buf), len(buf)))
+		st.ib.save(seq, offset)
+	}
+
+	if deleted != maxSequence-count {
+		return n, fmt.Errorf("%w: inconsistent count", ErrInvalidFormat)
+	}
+	if uint64(n-stringsStart) != stringsLen {
+		return n, fmt.Errorf("%w: inconsistent strings len", ErrInvalidFormat)
+	}
+
+	sum := cr.crc.Sum32()
+	var trailer [4]byte
+	if _, err := io.ReadFull(cr, trailer[:]); err != nil {
+		return n, unexpectedEOF(err)
+	}
+	if binary.LittleEndian.Uint32(trailer[:]) != sum {
+		return n, ErrChecksum
+	}
+
+	if !sameHash {
+		st.seed = newSeed()
+	}
+	if !keep {
+		st.rebuildTable()
+	}
+
+	*i = st
+	return n, nil
+}
+
+// readTable reads a hash table with l entries into a table with the given
+// layout. If keep is false the entries are validated and discarded. Space for
+// up to prealloc entries is allocated up front, and the rest as entries are
+// read, so a bad l can't make us allocate much more than the data we're given.
+func readTable[S Sequence](r io.Reader, l int, maxSequence uint64, keep bool, layout Layout, prealloc int) (table[S], error) {
+	if l == 0 {
+		return table[S]{}, nil
+	}
+	var entries []tableEntry[S]
+	if keep {
+		entries = make([]tableEntry[S], 0, min(l, prealloc))
+	}
+	var b [12]byte
+	buf := b[:4+unsafe.Sizeof(S(0))]
+	for range l {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return table[S]{}, unexpectedEOF(err)
+		}
+		e := tableEntry[S]{
+			hash:     binary.LittleEndian.Uint32(buf),
+			sequence: readSequence[S](buf[4:]),
+		}
+		if uint64(e.sequence) > maxSequence && e.sequence != tombstone[S]() {
+			return table[S]{}, fmt.Errorf("%w: sequence %d out of range", ErrInvalidFormat, e.sequence)
+		}
+		if keep {
+			entries = append(entries, e)
+		}
+	}
+	if !keep {
+		return table[S]{}, nil
+	}
+	t := table[S]{entries: entries[:l:l]}
+	if layout == LayoutSwiss {
+		t.ctrl = make([]uint64, l/groupSize)
+		t.initCtrl()
+	}
+	return t, nil
+}
+
+// rebuildTable recreates the hash table from the stored strings. We use this
+// if the serialized hashes were created by a different hash function, or the
+// table has a different layout.
+func (i *Tab[S]) rebuildTable() {
+	l := 16
+	for i.count >= i.tuning.growAt(l) {
+		l *= 2
+	}
+	i.table = newTable[S](l, i.tuning.layout)
+	i.oldTable = table[S]{}
+	i.oldTableCursor = 0
+	i.next, i.nextLen = nil, 0
+	i.tombstones = 0
+	for seq, val := range i.All() {
+		i.copyEntryToTable(i.table, i.hash.sum32(val, i.seed), seq)
+	}
+}
+
+// appendSequence appends seq to buf, using as many bytes as S has
+func appendSequence[S Sequence](buf []byte, seq S) []byte {
+	switch unsafe.Sizeof(seq) {
+	case 2:
+		return binary.LittleEndian.AppendUint16(buf, uint16(seq))
+	case 4:
+		return binary.LittleEndian.AppendUint32(buf, uint32(seq))
+	default:
+		return binary.LittleEndian.AppendUint64(buf, uint64(seq))
+	}
+}
+
+// readSequence reads a sequence number written by appendSequence
+func readSequence[S Sequence](buf []byte) S {
+	switch unsafe.Sizeof(S(0)) {
+	case 2:
+		return S(binary.LittleEndian.Uint16(buf))
+	case 4:
+		return S(binary.LittleEndian.Uint32(buf))
+	default:
+		return S(binary.LittleEndian.Uint64(buf))
+	}
+}
+
+// appendStringPrefix appends what we write before the string for seq to buf,
+// and returns the string. For deleted sequence numbers the string is empty.
+func (i *Tab[S]) appendStringPrefix(buf []byte, seq S) ([]byte, string) {
+	val, ok := i.LookupSequence(seq)
+	if !ok {
+		buf = binary.AppendUvarint(buf, 0)
+		return binary.AppendUvarint(buf, uint64(i.ib.nextFree(seq))), ""
+	}
+	return binary.AppendUvarint(buf, uint64(len(val))+1), val
+}
+
+// hashFingerprint identifies the hash function and seed in use by the SymbolTab
+// in this process
+func (i *Tab[S]) hashFingerprint() uint64 {
+	return uint64(i.hash.sum32("symboltab", i.seed))<<32 | uint64(i.hash.sum32("fingerprint", i.seed))
+}
+
+// validTableLen returns true if l is a table size that could have been
+// created by a SymbolTab
+func validTableLen(l uint64) bool {
+	return l >= 16 && l <= uint64(maxTableLen) && l&(l-1) == 0
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// byteReader is what we need to read a table. binary.ReadUvarint needs
+// ReadByte.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// checksumReader updates a checksum with all the data read through it, and
+// counts the bytes read in n
+type checksumReader struct {
+	r   byteReader
+	crc hash.Hash32
+	n   *int64
+	b   [1]byte
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc.Write(p[:n])
+	*c.n += int64(n)
+	return n, err
+}
+
+func (c *checksumReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	c.b[0] = b
+	c.crc.Write(c.b[:])
+	*c.n++
+	return b, nil
+}
@@ -0,0 +1,255 @@
+package symboltab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerialize(t *testing.T) {
+	st := New(16)
+	// 8,500 entries leaves the table part way through a resize, so we
+	// check the old table is carried across too
+	for i := range 8_500 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.NotZero(t, st.oldTable.len())
+
+	var buf bytes.Buffer
+	written, err := st.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), written)
+
+	var st2 SymbolTab
+	read, err := st2.ReadFrom(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, written, read)
+
+	assert.Equal(t, st.Len(), st2.Len())
+	assert.Equal(t, st.Cap(), st2.Cap())
+	for i := range 8_500 {
+		seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), st2.SequenceToString(uint32(i+1)))
+	}
+
+	// The reloaded table should carry on growing as normal
+	for i := 8_500; i < 20_000; i++ {
+		seq, found := st2.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	for i := range 20_000 {
+		seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+}
+
+func TestSerializeOtherHash(t *testing.T) {
+	st := New(16)
+	for i := range 8_500 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	var buf bytes.Buffer
+	_, err := st.WriteTo(&buf)
+	require.NoError(t, err)
+
+	// Simulate data written by a process with a different hash seed by
+	// changing the fingerprint and fixing up the checksum.
+	data := buf.Bytes()
+	data[16]++
+	fixChecksums(data)
+
+	var st2 SymbolTab
+	_, err = st2.ReadFrom(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Zero(t, st2.oldTable.len())
+	for i := range 8_500 {
+		seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	seq, found := st2.StringToSequence("hat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(8_501), seq)
+}
+
+func TestSerializeEmpty(t *testing.T) {
+	for _, st := range []*SymbolTab{{}, New(0)} {
+		var buf bytes.Buffer
+		_, err := st.WriteTo(&buf)
+		require.NoError(t, err)
+
+		var st2 SymbolTab
+		_, err = st2.ReadFrom(&buf)
+		require.NoError(t, err)
+		assert.Zero(t, st2.Len())
+
+		seq, found := st2.StringToSequence("hat", true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(1), seq)
+	}
+}
+
+func TestSerializeCorrupt(t *testing.T) {
+	st := New(16)
+	for i := range 100 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	var buf bytes.Buffer
+	_, err := st.WriteTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	t.Run("magic", func(t *testing.T) {
+		bad := bytes.Clone(data)
+		bad[0] = 'X'
+		var st2 SymbolTab
+		_, err := st2.ReadFrom(bytes.NewReader(bad))
+		assert.True(t, errors.Is(err, ErrInvalidFormat))
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		bad := bytes.Clone(data)
+		bad[len(bad)-5]++
+		var st2 SymbolTab
+		_, err := st2.ReadFrom(bytes.NewReader(bad))
+		assert.True(t, errors.Is(err, ErrChecksum))
+	})
+
+	t.Run("table len", func(t *testing.T) {
+		// The header checksum catches this before we allocate the table
+		bad := bytes.Clone(data)
+		binary.LittleEndian.PutUint64(bad[56:], 1<<32)
+		var st2 SymbolTab
+		_, err := st2.ReadFrom(bytes.NewReader(bad))
+		assert.True(t, errors.Is(err, ErrChecksum))
+	})
+
+	t.Run("valid huge table len", func(t *testing.T) {
+		// Even with a good checksum, we don't allocate space for entries
+		// that aren't there
+		bad := bytes.Clone(data)
+		binary.LittleEndian.PutUint64(bad[56:], 1<<32)
+		fixChecksums(bad)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		var st2 SymbolTab
+		_, err := st2.ReadFrom(bytes.NewReader(bad))
+		runtime.ReadMemStats(&after)
+		assert.Error(t, err)
+		assert.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20, after.TotalAlloc-before.TotalAlloc)
+	})
+
+	t.Run("strings len", func(t *testing.T) {
+		bad := bytes.Clone(data)
+		binary.LittleEndian.PutUint64(bad[104:], binary.LittleEndian.Uint64(bad[104:])+1)
+		fixChecksums(bad)
+		var st2 SymbolTab
+		_, err := st2.ReadFrom(bytes.NewReader(bad))
+		assert.True(t, errors.Is(err, ErrInvalidFormat), err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var st2 SymbolTab
+		st2.StringToSequence("hat", true)
+		_, err := st2.ReadFrom(bytes.NewReader(data[:len(data)-1]))
+		assert.Error(t, err)
+		// The table should be unchanged
+		assert.Equal(t, 1, st2.Len())
+		assert.Equal(t, "hat", st2.SequenceToString(1))
+	})
+}
+
+func TestSerializeStream(t *testing.T) {
+	// Tables written one after another can be read back one after another,
+	// whether or not the reader can read a byte at a time
+	var tabs [2]*SymbolTab
+	var buf bytes.Buffer
+	var written [2]int64
+	for j := range tabs {
+		tabs[j] = New(16)
+		for i := range 100 * (j + 1) {
+			tabs[j].StringToSequence(strconv.Itoa(i*(j+1)), true)
+		}
+		var err error
+		written[j], err = tabs[j].WriteTo(&buf)
+		require.NoError(t, err)
+	}
+	data := buf.Bytes()
+
+	for name, r := range map[string]io.Reader{
+		"byte reader":     bytes.NewReader(data),
+		"not byte reader": struct{ io.Reader }{bytes.NewReader(data)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for j := range tabs {
+				var st SymbolTab
+				read, err := st.ReadFrom(r)
+				require.NoError(t, err)
+				assert.Equal(t, written[j], read)
+				assert.Equal(t, tabs[j].Len(), st.Len())
+				for seq, val := range tabs[j].All() {
+					assert.Equal(t, val, st.SequenceToString(seq))
+				}
+			}
+			n, err := r.Read(make([]byte, 1))
+			assert.Zero(t, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+// fixChecksums recalculates the checksums in a serialized table after it has
+// been changed
+func fixChecksums(data []byte) {
+	binary.LittleEndian.PutUint32(data[serialHeaderSize:], crc32.Checksum(data[:serialHeaderSize], castagnoli))
+	binary.LittleEndian.PutUint32(data[len(data)-4:], crc32.Checksum(data[:len(data)-4], castagnoli))
+}
+
+func TestSerializeHash(t *testing.T) {
+	fixed := HashCustom("fixed", func(b []byte) uint64 { return 37 })
+	for _, hash := range []Hash{HashRuntime, HashMaphash, HashXXH3, HashWyhash, fixed} {
+		t.Run(hash.String(), func(t *testing.T) {
+			st := NewWithHash(16, hash)
+			for i := range 1000 {
+				st.StringToSequence(strconv.Itoa(i), true)
+			}
+			var buf bytes.Buffer
+			_, err := st.WriteTo(&buf)
+			require.NoError(t, err)
+			data := buf.Bytes()
+
+			st2 := NewWithHash(16, hash)
+			_, err = st2.ReadFrom(bytes.NewReader(data))
+			require.NoError(t, err)
+			for i := range 1000 {
+				seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+				assert.True(t, found)
+				assert.Equal(t, uint32(i+1), seq)
+			}
+
+			// Reading with a different hash function fails
+			other := HashXXH3
+			if hash.equal(HashXXH3) {
+				other = HashWyhash
+			}
+			for _, other := range []Hash{other, HashCustom("other", func(b []byte) uint64 { return 37 })} {
+				st3 := NewWithHash(16, other)
+				_, err = st3.ReadFrom(bytes.NewReader(data))
+				assert.True(t, errors.Is(err, ErrHashMismatch), err)
+				assert.Zero(t, st3.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package symboltab
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedSymbolTab is a symbol table that is safe for concurrent use and is
+// intended for adding strings from many goroutines at once. Strings are
+// divided between a number of independent SymbolTabs by their hash, and each
+// of these shards has its own lock.
+//
+// Sequence numbers are still allocated densely from 1 across the whole table.
+// Each shard records the global sequence number for each of its strings, and
+// we keep a global record of which shard holds each sequence number.
+type ShardedSymbolTab struct {
+	shards []shard
+	// shift converts a hash into a shard number. We use the top bits of the
+	// hash to pick the shard, as the shard's SymbolTab uses the bottom bits.
+	shift uint
+	// next is the last sequence number allocated. count is the number of
+	// sequence numbers whose locations have been stored, so every sequence
+	// number up to Len() can be looked up. Shards add strings concurrently,
+	// so count can lag behind next.
+	next  atomic.Uint32
+	count atomic.Uint32
+	// seed is the hash seed. The shards are passed the hash, so their own
+	// seeds are not used.
+	seed uintptr
+
+	// locations maps a global sequence number to the shard number (top 32
+	// bits) and the sequence number within that shard. growMu protects growing
+	// locations, as shards save to it concurrently.
+	growMu    sync.Mutex
+	locations concurrentIntbank
+}
+
+type shard struct {
+	mu sync.RWMutex
+	st SymbolTab
+	// globals maps the shard's sequence numbers to the global sequence number
+	globals intbank[uint32]
+	// pad so each shard's lock is on its own cache line
+	_ [64]byte
+}
+
+// NewSharded creates a new ShardedSymbolTab. shards is the number of shards,
+// and is rounded up to a power of 2. It should be a few times larger than the
+// number of goroutines adding strings. cap is the initial capacity of the whole
+// table.
+func NewSharded(shards int, cap int) *ShardedSymbolTab {
+	if shards < 1 {
+		shards = 1
+	}
+	shardBits := bits.Len(uint(shards - 1))
+	s := &ShardedSymbolTab{
+		shards: make([]shard, 1<<shardBits),
+		shift:  uint(32 - shardBits),
+		seed:   newSeed(),
+	}
+	for j := range s.shards {
+		s.shards[j].st = *New(cap >> shardBits)
+	}
+	return s
+}
+
+// Len returns the number of unique strings stored
+func (s *ShardedSymbolTab) Len() int {
+	return int(s.count.Load())
+}
+
+// SequenceToString looks up a string by its sequence number. Obtain the
+// sequence number for a string with StringToSequence
+func (s *ShardedSymbolTab) SequenceToString(seq uint32) string {
+	loc := s.locations.lookup(seq)
+	sh := &s.shards[loc>>32]
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return sh.st.SequenceToString(uint32(loc))
+}
+
+// StringToSequence looks up the string val and returns its sequence number seq. If val does
+// not currently exist in the symbol table, it will add it if addNew is true. found indicates
+// whether val was already present in the ShardedSymbolTab
+func (s *ShardedSymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
+	hash := stringHash(val, s.seed)
+	shardNo := hash >> s.shift
+	sh := &s.shards[shardNo]
+
+	// Look for the string with just the read lock first. SymbolTab does not
+	// change anything when addNew is false.
+	sh.mu.RLock()
+	local, found, _ := sh.st.stringToSequence(val, hash, false)
+	if found {
+		seq = uint32(sh.globals.lookup(local))
+	}
+	sh.mu.RUnlock()
+	if found || !addNew {
+		return seq, found
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	local, found, err := sh.st.stringToSequence(val, hash, true)
+	if err != nil {
+		return 0, false
+	}
+	if found {
+		// Someone else added it since we looked
+		return uint32(sh.globals.lookup(local)), true
+	}
+
+	seq = s.next.Add(1)
+	sh.globals.save(local, int(seq))
+	if !s.locations.has(seq) {
+		s.growMu.Lock()
+		s.locations.grow(seq)
+		s.growMu.Unlock()
+	}
+	s.locations.set(seq, uint64(shardNo)<<32|uint64(local))
+	s.publish()
+	return seq, false
+}
+
+// publish advances count over each sequence number whose location has been
+// stored. Locations are never zero, as local sequence numbers start at 1.
+// Each goroutine stores its location before calling publish, so whichever
+// stores the location count is waiting for will move count past it.
+func (s *ShardedSymbolTab) publish() {
+	for {
+		n := s.count.Load()
+		if n == s.next.Load() || !s.locations.has(n+1) || s.locations.lookup(n+1) == 0 {
+			return
+		}
+		s.count.CompareAndSwap(n, n+1)
+	}
+}
@@ -0,0 +1,174 @@
+package symboltab
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharded(t *testing.T) {
+	st := NewSharded(4, 16)
+
+	seq, found := st.StringToSequence("hat", false)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+
+	for i := range 10_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(uint32(i+1)))
+	}
+	assert.Equal(t, 10_000, st.Len())
+
+	// Strings should be spread across the shards
+	for j := range st.shards {
+		assert.NotZero(t, st.shards[j].st.Len())
+	}
+}
+
+func TestShardedOneShard(t *testing.T) {
+	st := NewSharded(0, 0)
+	assert.Len(t, st.shards, 1)
+	for i := range 1000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	assert.Equal(t, "37", st.SequenceToString(38))
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	const (
+		writers   = 8
+		perWriter = 20_000
+	)
+	st := NewSharded(16, 0)
+
+	// Each writer adds some strings of its own and some shared with the
+	// other writers
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				val := strconv.Itoa(i)
+				if i%2 == 0 {
+					val = strconv.Itoa(w) + "-" + val
+				}
+				seq, _ := st.StringToSequence(val, true)
+				if str := st.SequenceToString(seq); str != val {
+					t.Errorf("sequence %d returned %s, expected %s", seq, str, val)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := writers*perWriter/2 + perWriter/2
+	assert.Equal(t, expected, st.Len())
+
+	// Every sequence number from 1 to Len should map to a unique string that
+	// maps back to the same sequence number
+	seen := make(map[string]bool, expected)
+	for seq := uint32(1); seq <= uint32(expected); seq++ {
+		str := st.SequenceToString(seq)
+		assert.False(t, seen[str])
+		seen[str] = true
+		seq2, found := st.StringToSequence(str, false)
+		assert.True(t, found)
+		assert.Equal(t, seq, seq2)
+	}
+}
+
+func TestShardedReadWhileWriting(t *testing.T) {
+	const (
+		writers   = 4
+		perWriter = 20_000
+	)
+	st := NewSharded(8, 0)
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				st.StringToSequence(strconv.Itoa(w)+"-"+strconv.Itoa(i), true)
+			}
+		}()
+	}
+	var done atomic.Bool
+	go func() {
+		wg.Wait()
+		done.Store(true)
+	}()
+
+	// Every sequence number up to Len must be readable as soon as Len covers
+	// it
+	for !done.Load() {
+		n := uint32(st.Len())
+		if n == 0 {
+			continue
+		}
+		for _, seq := range []uint32{1, n / 2, n} {
+			if seq == 0 {
+				continue
+			}
+			if str := st.SequenceToString(seq); str == "" {
+				t.Fatalf("sequence %d of %d has no string", seq, n)
+			}
+		}
+	}
+	assert.Equal(t, writers*perWriter, st.Len())
+}
+
+// Run these benchmarks with -cpu 1,2,4,8 to see how they scale
+func BenchmarkShardedParallel(b *testing.B) {
+	symbols := make([]string, b.N)
+	for i := range symbols {
+		symbols[i] = strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	st := NewSharded(64, 0)
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			st.StringToSequence(symbols[next.Add(1)-1], true)
+		}
+	})
+}
+
+func BenchmarkMutexParallel(b *testing.B) {
+	symbols := make([]string, b.N)
+	for i := range symbols {
+		symbols[i] = strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	st := New(0)
+	var mu sync.Mutex
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sym := symbols[next.Add(1)-1]
+			mu.Lock()
+			st.StringToSequence(sym, true)
+			mu.Unlock()
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package symboltab
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// statsSampleSize is the most table entries Stats looks at. Larger tables are
+// sampled in statsChunks runs of entries spread evenly across the table.
+const (
+	statsSampleSize = 1 << 16
+	statsChunks     = 64
+)
+
+// Stats describes the health of a SymbolTab. See Stats.
+type Stats struct {
+	// Len is the number of strings stored
+	Len int
+	// Cap is the number of entries in the hash table
+	Cap int
+	// Tombstones is the number of table entries marking deleted strings
+	Tombstones int
+	// LoadFactor is the fraction of the table in use, including tombstones.
+	// The table grows when this reaches the max load, which is 0.5 unless
+	// set with WithMaxLoad.
+	LoadFactor float64
+
+	// Resizes is the number of times the table has grown, or been rebuilt at
+	// the same size to clear out tombstones.
+	Resizes int
+	// Resizing is true if the table is part way through growing. OldTableLen is
+	// the size of the old table, and OldTableCursor is how many of its entries
+	// have been copied to the new table.
+	Resizing       bool
+	OldTableLen    int
+	OldTableCursor int
+
+	// Sampled is the number of table entries examined to make ProbeHistogram,
+	// MaxProbe and Collisions. If it is less than Cap, these are from a
+	// sample of the table.
+	Sampled int
+	// ProbeHistogram counts strings by the number of other entries a lookup
+	// has to step over to find them. Bucket 0 counts strings found straight
+	// away, bucket 1 those that step over 1 entry, bucket 2 those that step
+	// over 2 or 3, bucket 3 4 to 7, and so on. The last bucket counts everything
+	// longer. With LayoutSwiss a lookup looks at a group of 8 entries at once,
+	// so these count all the entries in the groups stepped over.
+	ProbeHistogram [16]int
+	// MaxProbe is the most entries stepped over to find any one string
+	MaxProbe int
+	// Collisions is the number of strings that have the same hash as a string
+	// that was already in the table. Lookups for these strings have to compare
+	// the strings themselves.
+	Collisions int
+	// LongProbes and LongestProbe are the same as the values returned by
+	// LongProbes. Unlike the other probe stats they count lookups, not strings.
+	LongProbes   int
+	LongestProbe int
+
+	// TableBytes, OldTableBytes, IntbankBytes and StringBytes are the memory
+	// used by the hash table, the old hash table during a resize, the mapping
+	// from sequence numbers to strings and the strings themselves.
+	TableBytes    int
+	OldTableBytes int
+	IntbankBytes  int
+	StringBytes   int
+}
+
+// Stats returns statistics about the SymbolTab. It only looks at a limited
+// sample of the hash table, so it is cheap enough to call periodically even for
+// very large tables. It doesn't change the SymbolTab, so may be called
+// concurrently with lookups.
+func (i *Tab[S]) Stats() Stats {
+	s := Stats{
+		Len:           i.count,
+		Cap:           i.table.len(),
+		Tombstones:    i.tombstones,
+		Resizes:       i.resizes,
+		Resizing:      i.oldTable.len() != 0,
+		OldTableLen:   i.oldTable.len(),
+		TableBytes:    i.table.size(),
+		OldTableBytes: i.oldTable.size(),
+		StringBytes:   i.sb.Size(),
+	}
+	if s.Resizing {
+		s.OldTableCursor = i.oldTableCursor
+	}
+	if s.Cap != 0 {
+		s.LoadFactor = float64(i.count+i.tombstones) / float64(s.Cap)
+	}
+	s.LongProbes, s.LongestProbe = i.LongProbes()
+	for _, slab := range i.ib.slabs {
+		if !isDeletedSlab(slab) {
+			s.IntbankBytes += len(slab) * int(unsafe.Sizeof(int(0)))
+		}
+	}
+
+	i.table.sampleProbes(&s)
+	return s
+}
+
+// sampleProbes fills in the probe and collision stats from a sample of the
+// table
+func (t table[S]) sampleProbes(s *Stats) {
+	l := t.len()
+	if l == 0 {
+		return
+	}
+	chunks, chunkLen := 1, l
+	if l > statsSampleSize {
+		chunks, chunkLen = statsChunks, statsSampleSize/statsChunks
+	}
+	for c := range chunks {
+		start := c * (l / chunks)
+		for cursor := start; cursor < start+chunkLen; cursor++ {
+			s.Sampled++
+			e := t.entries[cursor]
+			if !e.live() {
+				continue
+			}
+			var probes int
+			var collision bool
+			if t.ctrl != nil {
+				probes, collision = t.groupProbe(cursor, e.hash)
+			} else {
+				probes, collision = t.linearProbe(cursor, e.hash)
+			}
+			s.ProbeHistogram[min(bits.Len(uint(probes)), len(s.ProbeHistogram)-1)]++
+			s.MaxProbe = max(s.MaxProbe, probes)
+			if collision {
+				s.Collisions++
+			}
+		}
+	}
+}
+
+// linearProbe returns the number of entries a lookup for the entry at cursor
+// steps over in the linear layout, and whether it passes an entry with the same
+// hash first.
+func (t table[S]) linearProbe(cursor int, hash uint32) (probes int, collision bool) {
+	// The entry's distance from where its hash would put it is the number of
+	// entries a lookup steps over to find it
+	mask := t.len() - 1
+	probes = (cursor - int(hash)) & mask
+
+	// Entries with the same hash are in the same run, and between this entry
+	// and where its hash would put it
+	for j := 1; j <= probes; j++ {
+		if o := t.entries[(cursor-j)&mask]; o.live() && o.hash == hash {
+			return probes, true
+		}
+	}
+	return probes, false
+}
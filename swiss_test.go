@@ -0,0 +1,311 @@
+package symboltab
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCtrlGroup(t *testing.T) {
+	a, b := ctrlHash(0x12345678), ctrlHash(0x82345678)
+	// Entries 0 and 5 are a, 2 is b, 3 and 6 are deleted, the rest are empty
+	g := ctrlGroup(a | b<<16 | ctrlDeleted<<24 | a<<40 | ctrlDeleted<<48)
+
+	var got []int
+	for m := g.matchHash(a); m != 0; m = m.removeFirst() {
+		got = append(got, m.first())
+	}
+	assert.Equal(t, []int{0, 5}, got)
+
+	got = got[:0]
+	for m := g.matchEmpty(); m != 0; m = m.removeFirst() {
+		got = append(got, m.first())
+	}
+	assert.Equal(t, []int{1, 4, 7}, got)
+
+	got = got[:0]
+	for m := g.matchEmptyOrDeleted(); m != 0; m = m.removeFirst() {
+		got = append(got, m.first())
+	}
+	assert.Equal(t, []int{1, 3, 4, 6, 7}, got)
+
+	assert.Zero(t, ctrlGroup(0).matchHash(a))
+	assert.Zero(t, ctrlGroup(ctrlDeleted*ctrlLSBs).matchEmpty())
+}
+
+// checkCtrl checks the control bytes of a swiss table match its entries
+func checkCtrl[S Sequence](t *testing.T, tab table[S]) {
+	t.Helper()
+	for cursor, e := range tab.entries {
+		c := tab.ctrl[cursor/groupSize] >> (cursor % groupSize * 8) & 0xff
+		switch {
+		case e.sequence == 0:
+			require.Equal(t, uint64(ctrlEmpty), c, cursor)
+		case e.sequence == tombstone[S]():
+			require.Equal(t, uint64(ctrlDeleted), c, cursor)
+		default:
+			require.Equal(t, ctrlHash(e.hash), c, cursor)
+		}
+	}
+}
+
+func TestSwiss(t *testing.T) {
+	st, err := NewWithOptions(WithLayout(LayoutSwiss), WithMaxLoad(0.9))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(st.table.ctrl))
+
+	for i := range 100_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		require.False(t, found)
+		require.Equal(t, uint32(i+1), seq)
+	}
+	assert.Equal(t, 131072, st.Cap())
+	assert.Equal(t, 131072/groupSize, len(st.table.ctrl))
+	checkCtrl(t, st.table)
+
+	for i := range 100_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		require.True(t, found)
+		require.Equal(t, uint32(i+1), seq)
+	}
+	for i := range 1000 {
+		_, found := st.StringToSequence("miss"+strconv.Itoa(i), false)
+		require.False(t, found)
+	}
+
+	for i := 0; i < 100_000; i += 2 {
+		require.True(t, st.Delete(strconv.Itoa(i)))
+	}
+	checkCtrl(t, st.table)
+	// Entries in groups that have an empty entry are emptied rather than left
+	// as tombstones
+	assert.True(t, st.tombstones < 50_000)
+	var tombstones int
+	for _, e := range st.table.entries {
+		if e.sequence == tombstone[uint32]() {
+			tombstones++
+		}
+	}
+	assert.Equal(t, st.tombstones, tombstones)
+
+	for i := range 100_000 {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		require.Equal(t, i%2 == 1, found, i)
+		if found {
+			require.Equal(t, uint32(i+1), seq)
+		}
+	}
+
+	s := st.Stats()
+	assert.Equal(t, 131072*8+131072, s.TableBytes)
+	var total int
+	for _, n := range s.ProbeHistogram {
+		total += n
+	}
+	// The table is too big to look at all of it
+	assert.Equal(t, statsSampleSize, s.Sampled)
+	assert.True(t, total > 0)
+	assert.True(t, s.ProbeHistogram[0] > total/2)
+	assert.Zero(t, s.MaxProbe%groupSize)
+}
+
+func TestSwissGrowAndDelete(t *testing.T) {
+	// Keep adding and deleting strings so the table is rebuilt to clear out
+	// tombstones, with strings being added and deleted during the rebuilds
+	st, err := NewWithOptions(WithLayout(LayoutSwiss), WithMaxLoad(0.9), WithMigrationBatch(3))
+	require.NoError(t, err)
+	for i := range 50_000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+		if i >= 500 {
+			require.True(t, st.Delete(strconv.Itoa(i-500)))
+		}
+		if i%1001 == 0 {
+			checkCtrl(t, st.table)
+			if st.oldTable.len() != 0 {
+				checkCtrl(t, st.oldTable)
+			}
+		}
+	}
+	assert.Equal(t, 500, st.Len())
+	assert.True(t, st.Stats().Resizes > 0)
+	for i := range 50_000 {
+		_, found := st.StringToSequence(strconv.Itoa(i), false)
+		require.Equal(t, i >= 49_500, found, i)
+	}
+}
+
+func TestFindInGroupsFull(t *testing.T) {
+	var st SymbolTab
+	full := newTable[uint32](16, LayoutSwiss)
+	for j := range full.entries {
+		full.set(j, uint32(j), uint32(j+1))
+	}
+	cursor, seq := st.findInTable(full, "a", 1<<16+3)
+	assert.Equal(t, -1, cursor)
+	assert.Zero(t, seq)
+
+	// A tombstone is used if there's no empty entry
+	full.remove(7)
+	cursor, seq = st.findInTable(full, "a", 1<<16+3)
+	assert.Equal(t, 7, cursor)
+	assert.Zero(t, seq)
+}
+
+func TestSwissBatch(t *testing.T) {
+	st, err := NewWithOptions(WithLayout(LayoutSwiss))
+	require.NoError(t, err)
+	vals := make([]string, 10_000)
+	for i := range vals {
+		vals[i] = strconv.Itoa(i)
+	}
+	seqs := make([]uint32, len(vals))
+	assert.Equal(t, len(vals), st.StringsToSequences(vals, seqs, true))
+	checkCtrl(t, st.table)
+	assert.Zero(t, st.StringsToSequences(vals, seqs, false))
+	for i, seq := range seqs {
+		assert.Equal(t, uint32(i+1), seq)
+	}
+
+	st.Delete("37")
+	st.Renumber()
+	assert.NotNil(t, st.table.ctrl)
+	checkCtrl(t, st.table)
+	_, found := st.StringToSequence("38", false)
+	assert.True(t, found)
+}
+
+func TestSwissSerialize(t *testing.T) {
+	for _, from := range []Layout{LayoutLinear, LayoutSwiss} {
+		for _, to := range []Layout{LayoutLinear, LayoutSwiss} {
+			t.Run(from.String()+"-"+to.String(), func(t *testing.T) {
+				st, err := NewWithOptions(WithLayout(from))
+				require.NoError(t, err)
+				for i := range 10_000 {
+					st.StringToSequence(strconv.Itoa(i), true)
+				}
+				st.Delete("37")
+
+				var buf bytes.Buffer
+				_, err = st.WriteTo(&buf)
+				require.NoError(t, err)
+
+				st2, err := NewWithOptions(WithLayout(to))
+				require.NoError(t, err)
+				_, err = st2.ReadFrom(&buf)
+				require.NoError(t, err)
+
+				assert.Equal(t, to == LayoutSwiss, st2.table.ctrl != nil)
+				if to == LayoutSwiss {
+					checkCtrl(t, st2.table)
+				}
+				for i := range 10_000 {
+					seq, found := st2.StringToSequence(strconv.Itoa(i), false)
+					assert.Equal(t, i != 37, found)
+					if found {
+						assert.Equal(t, uint32(i+1), seq)
+					}
+				}
+			})
+		}
+	}
+}
+
+// layoutBenchLen is the size of table used to compare the layouts. It's big
+// enough that the table doesn't fit in the CPU caches.
+const layoutBenchLen = 1 << 20
+
+// benchLayouts runs fn for each layout with tables filled to loads up to the
+// highest WithMaxLoad allows
+func benchLayouts(b *testing.B, fn func(b *testing.B, opts []Option, n int)) {
+	for _, layout := range []Layout{LayoutLinear, LayoutSwiss} {
+		for _, load := range []float64{0.5, 0.75, 0.9} {
+			b.Run(layout.String()+"/load="+strconv.FormatFloat(load, 'f', -1, 64), func(b *testing.B) {
+				opts := []Option{
+					WithLayout(layout),
+					WithMaxLoad(maxMaxLoad),
+					WithCapacity(layoutBenchLen / 2),
+				}
+				fn(b, opts, int(layoutBenchLen*load))
+			})
+		}
+	}
+}
+
+// newBenchTab creates a table for benchLayouts with n strings in it
+func newBenchTab(b *testing.B, opts []Option, n int) *SymbolTab {
+	st, err := NewWithOptions(opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := range n {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	if st.Cap() != layoutBenchLen {
+		b.Fatalf("table has %d entries, expected %d", st.Cap(), layoutBenchLen)
+	}
+	return st
+}
+
+// BenchmarkSymbolTabLayout is like BenchmarkSymbolTab, but adds strings to a
+// fixed size table until it reaches the load, then starts again with an empty
+// table.
+func BenchmarkSymbolTabLayout(b *testing.B) {
+	benchLayouts(b, func(b *testing.B, opts []Option, n int) {
+		symbols := make([]string, n)
+		for i := range symbols {
+			symbols[i] = strconv.Itoa(i)
+		}
+		st := newBenchTab(b, opts, 0)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i, j := 0, 0; i < b.N; i, j = i+1, j+1 {
+			if j == n {
+				b.StopTimer()
+				st, j = newBenchTab(b, opts, 0), 0
+				b.StartTimer()
+			}
+			st.StringToSequence(symbols[j], true)
+		}
+	})
+}
+
+// BenchmarkExistingLayout is like BenchmarkExisting, but looks up strings in a
+// table filled to the load
+func BenchmarkExistingLayout(b *testing.B) {
+	benchLayouts(b, func(b *testing.B, opts []Option, n int) {
+		st := newBenchTab(b, opts, n)
+		values := make([]string, n)
+		for i := range values {
+			values[i] = strconv.Itoa(i)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := range b.N {
+			if _, found := st.StringToSequence(values[i%n], false); !found {
+				b.Fatalf("value %s not found", values[i%n])
+			}
+		}
+	})
+}
+
+// BenchmarkMissLayout is like BenchmarkMiss, but looks up strings that aren't
+// present in a table filled to the load
+func BenchmarkMissLayout(b *testing.B) {
+	benchLayouts(b, func(b *testing.B, opts []Option, n int) {
+		st := newBenchTab(b, opts, n)
+		values := make([]string, n)
+		for i := range values {
+			values[i] = strconv.Itoa(-1 - i)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := range b.N {
+			if _, found := st.StringToSequence(values[i%n], false); found {
+				b.Fatalf("found value %s", values[i%n])
+			}
+		}
+	})
+}
@@ -6,7 +6,9 @@
 package symboltab
 
 import (
-	"math/bits"
+	"errors"
+	"iter"
+	"math"
 	"reflect"
 	"unsafe"
 
@@ -17,80 +19,235 @@ import (
 // increased to at least 16 bytes per entry
 const loadFactor = 2
 
-// SymbolTab is the symbol table. Allocate it via New()
-type SymbolTab struct {
+// Sequence is the set of types that can be used for sequence numbers. The largest
+// value of the type is reserved, so a Tab[uint16] can hold 65534 strings.
+//
+// The type only changes how many sequence numbers there are, and so when
+// Insert starts returning ErrFull. It doesn't change how the table is stored.
+// Hashes are 32 bits for every type, and the hash table stops growing at 2^32
+// entries, so no Tab holds more than 3/4 of 2^32 strings. A Tab[uint64] only
+// gains from having sequence numbers that don't run out when strings are
+// deleted and added without RecycleSequences. Table entries are 8 bytes for
+// uint16 and uint32 and 16 bytes for uint64, and every type uses an int per
+// sequence number to find its string, so a Tab[uint16] is no smaller than a
+// SymbolTab.
+type Sequence interface {
+	~uint16 | ~uint32 | ~uint64
+}
+
+// tombstone is the sequence number we use in the table to mark entries that have been
+// deleted. Lookups step over tombstones, and new entries can be written over them.
+func tombstone[S Sequence]() S {
+	return ^S(0)
+}
+
+// ErrFull is returned by Insert if there is no space or there are no sequence
+// numbers left for new strings.
+var ErrFull = errors.New("symboltab: table is full")
+
+// SymbolTab is the symbol table with uint32 sequence numbers. Allocate it via
+// New()
+type SymbolTab = Tab[uint32]
+
+// Tab is a symbol table with sequence numbers of type S. Use SymbolTab unless
+// you need smaller or larger sequence numbers. Allocate it via NewTab()
+type Tab[S Sequence] struct {
 	sb             stringbank.Stringbank
-	table          table
-	oldTable       table
+	table          table[S]
+	oldTable       table[S]
 	count          int
 	oldTableCursor int
-	ib             intbank
+	ib             intbank[S]
+
+	// maxSequence is the highest sequence number allocated. It can be larger than
+	// count if strings have been deleted.
+	maxSequence S
+	// tombstones is the number of tombstones in table
+	tombstones int
+	// deadBytes is roughly the space used by deleted strings in sb, and in ib
+	// if sequence numbers are not recycled. See Delete.
+	deadBytes int
+	// resizes is the number of times the table has been replaced, either by a
+	// larger one or to clear out tombstones
+	resizes int
+	// tuning controls how the table grows. See NewWithOptions.
+	tuning tuning
+	// next delivers the table we will grow into, which is allocated in the
+	// background as table fills up. nextLen is the length it will have, and is
+	// non-zero once we've started. See prepareNext.
+	next    chan table[S]
+	nextLen int
+	// reserveLen is the length StringsToSequences wants the next resize to
+	// grow the table to, if that is larger than it would normally grow. See
+	// reserve.
+	reserveLen int
+	// freeList is the most recently deleted sequence number. The intbank entries for
+	// deleted sequence numbers link them into a list. See intbank.
+	freeList S
+	recycle  bool
+
+	// index is the sorted index used by PrefixScan and RangeScan. It is nil
+	// until one of them is called.
+	index *index[S]
+
+	hash Hash
+	// seed is the seed for HashRuntime. It is chosen randomly when the table is
+	// created, which means that anyone who can choose the strings that are
+	// added can't easily find strings that collide.
+	seed uintptr
+
+	// probeLimit, onLongProbe, longProbes and longestProbe are for detecting
+	// lookups that have to step over a lot of entries. See SetProbeLimit.
+	probeLimit   int
+	onLongProbe  func(probes int)
+	longProbes   uint32
+	longestProbe uint32
 }
 
 // New creates a new SymbolTab. cap is the initial capacity of the table - it will grow
 // automatically when needed
 func New(cap int) *SymbolTab {
+	return NewTab[uint32](cap)
+}
+
+// NewTab creates a new Tab with sequence numbers of type S. cap is the initial
+// capacity of the table - it will grow automatically when needed
+func NewTab[S Sequence](cap int) *Tab[S] {
 	// want to allocate a table large enough to hold cap without growing
-	cap = cap * loadFactor
-	if cap < 16 {
-		cap = 16
-	} else {
-		cap = 1 << uint(64-bits.LeadingZeros(uint(cap-1)))
-	}
-	return &SymbolTab{
-		table: table{
-			entries: make([]tableEntry, cap),
-		},
+	return &Tab[S]{
+		table: newTable[S](tuning{}.tableLen(cap), LayoutLinear),
+		seed:  newSeed(),
 	}
 }
 
 // Len returns the number of unique strings stored
-func (i *SymbolTab) Len() int {
+func (i *Tab[S]) Len() int {
 	return i.count
 }
 
 // Cap returns the size of the SymbolTab table
-func (i *SymbolTab) Cap() int {
+func (i *Tab[S]) Cap() int {
 	return i.table.len()
 }
 
 // SymbolSize contains the approximate size of string storage in the symboltable. This will be an over-estimate and
 // includes as yet unused and wasted space
-func (i *SymbolTab) SymbolSize() int {
+func (i *Tab[S]) SymbolSize() int {
 	return i.sb.Size()
 }
 
 // SequenceToString looks up a string by its sequence number. Obtain the sequence number
-// for a string with StringToSequence
-func (i *SymbolTab) SequenceToString(seq uint32) string {
+// for a string with StringToSequence. SequenceToString panics if seq is not a valid
+// sequence number, or has been deleted. Use LookupSequence if seq may not be valid.
+func (i *Tab[S]) SequenceToString(seq S) string {
 	// Look up the stringbank offset for this sequence number, then get the string
 	offset := i.ib.lookup(seq)
 	return i.sb.Get(offset)
 }
 
-// We use the runtime's map hash function without the overhead of using
-// hash/maphash
-//
-//go:linkname runtime_memhash runtime.memhash
-//go:noescape
-func runtime_memhash(p unsafe.Pointer, seed, s uintptr) uintptr
+// LookupSequence looks up a string by its sequence number. Unlike SequenceToString it
+// does not panic if seq is not valid. If nothing has been deleted, valid sequence
+// numbers run from 1 to Len() inclusive. If seq is 0, has not been allocated, or
+// has been deleted, ok is false.
+func (i *Tab[S]) LookupSequence(seq S) (val string, ok bool) {
+	if seq == 0 || seq > i.maxSequence {
+		return "", false
+	}
+	offset := i.ib.lookup(seq)
+	if offset < 0 {
+		return "", false
+	}
+	return i.sb.Get(offset), true
+}
+
+// All returns an iterator over the sequence numbers and strings in the
+// SymbolTab, in sequence order. Deleted sequence numbers are skipped. Strings
+// added during iteration may or may not be included.
+func (i *Tab[S]) All() iter.Seq2[S, string] {
+	return func(yield func(S, string) bool) {
+		for seq := S(1); seq <= i.maxSequence; seq++ {
+			if val, ok := i.LookupSequence(seq); ok {
+				if !yield(seq, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Strings returns an iterator over the strings in the SymbolTab, in sequence
+// order
+func (i *Tab[S]) Strings() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, val := range i.All() {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+// stringHash returns the hash we use for val in the table. Note that the
+// runtime's hash is randomised per process, so these hashes are only meaningful
+// within a single process. We also seed it differently for each table.
+func stringHash(val string, seed uintptr) uint32 {
+	return uint32(memhash(
+		unsafe.Pointer((*reflect.StringHeader)(unsafe.Pointer(&val)).Data),
+		seed,
+		uintptr(len(val)),
+	))
+}
 
 // StringToSequence looks up the string val and returns its sequence number seq. If val does
 // not currently exist in the symbol table, it will add it if addNew is true. found indicates
 // whether val was already present in the SymbolTab
-func (i *SymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found bool) {
+//
+// If there is no space or there are no sequence numbers left, StringToSequence
+// does not add val and returns 0. Use Insert to find out why.
+func (i *Tab[S]) StringToSequence(val string, addNew bool) (seq S, found bool) {
+	if addNew && i.seed == 0 {
+		i.initSeed()
+	}
+	seq, found, _ = i.stringToSequence(val, i.hash.sum32(val, i.seed), addNew)
+	return seq, found
+}
+
+// Insert looks up the string val and returns its sequence number seq, adding
+// val if it is not already present. found indicates whether val was already
+// present. If val can't be added, Insert returns ErrFull and the table is
+// unchanged.
+func (i *Tab[S]) Insert(val string) (seq S, found bool, err error) {
+	if i.seed == 0 {
+		i.initSeed()
+	}
+	return i.stringToSequence(val, i.hash.sum32(val, i.seed), true)
+}
+
+// initSeed chooses the hash seed for a zero value SymbolTab. It must be called
+// before hashing any string that is to be added.
+func (i *Tab[S]) initSeed() {
+	i.seed = newSeed()
+}
+
+// BytesToSequence is like StringToSequence, but takes a byte slice. It does not
+// allocate, and val is only copied if it is added to the table.
+func (i *Tab[S]) BytesToSequence(val []byte, addNew bool) (seq S, found bool) {
+	// The string only lives for the duration of this call, and the stringbank
+	// copies it if it is saved, so it's safe to avoid the copy here.
+	return i.StringToSequence(unsafe.String(unsafe.SliceData(val), len(val)), addNew)
+}
+
+// stringToSequence is Insert for when the caller already has the hash of val, and
+// may not want to add it
+func (i *Tab[S]) stringToSequence(val string, hash uint32, addNew bool) (seq S, found bool, err error) {
 	// we use a hashtable where the keys are stringbank offsets, but comparisons are done on
 	// strings. There is no value to store
 
-	hash := uint32(runtime_memhash(
-		unsafe.Pointer((*reflect.StringHeader)(unsafe.Pointer(&val)).Data),
-		0,
-		uintptr(len(val)),
-	))
-
 	if addNew {
 		// We're going to add to the table, make sure it is big enough
-		i.resize()
+		if err := i.resize(); err != nil {
+			return 0, false, err
+		}
 	}
 
 	if i.oldTable.len() != 0 {
@@ -104,67 +261,119 @@ func (i *SymbolTab) StringToSequence(val string, addNew bool) (seq uint32, found
 		// only. Certainly if we add we want to add to the new table
 		_, sequence := i.findInTable(i.oldTable, val, hash)
 		if sequence != 0 {
-			return sequence, true
+			return sequence, true, nil
 		}
 	}
 
 	cursor, sequence := i.findInTable(i.table, val, hash)
 	if sequence != 0 {
-		return sequence, true
+		return sequence, true, nil
 	}
 
 	if !addNew {
-		return 0, false
+		return 0, false, nil
+	}
+	if cursor < 0 {
+		return 0, false, ErrFull
 	}
 
 	// String was not found, so we want to store it. Cursor is the index where we should
 	// store it
+	sequence, ok := i.nextSequence()
+	if !ok {
+		return 0, false, ErrFull
+	}
 	i.count++
-	sequence = uint32(i.count)
-	i.table.entries[cursor] = tableEntry{
-		hash:     hash,
-		sequence: sequence,
+	if i.table.isTombstone(cursor) {
+		i.tombstones--
 	}
+	i.table.set(cursor, hash, sequence)
 
 	offset := i.sb.Save(val)
 	i.ib.save(sequence, offset)
+	i.indexAdd(sequence)
+
+	return sequence, false, nil
+}
 
-	return sequence, false
+// nextSequence returns the sequence number for a new string. This is a recycled
+// sequence number if recycling is on and there are any, otherwise the next unused one.
+// ok is false if there are none left.
+func (i *Tab[S]) nextSequence() (seq S, ok bool) {
+	if i.recycle && i.freeList != 0 {
+		seq := i.freeList
+		i.freeList = i.ib.takeFree(seq)
+		return seq, true
+	}
+	if i.maxSequence == tombstone[S]()-1 {
+		return 0, false
+	}
+	i.maxSequence++
+	return i.maxSequence, true
 }
 
 // findInTable find the string val in the hash table. If the string is present, it returns the
-// place in the table where it was found, plus the stringbank offset of the string + 1
-func (i *SymbolTab) findInTable(table table, val string, hashVal uint32) (cursor int, sequence uint32) {
+// place in the table where it was found, plus the stringbank offset of the string + 1. If not
+// the cursor is where the string should be added. This may be a tombstone. If the
+// string is not present and the table has no space the cursor is -1.
+func (i *Tab[S]) findInTable(table table[S], val string, hashVal uint32) (cursor int, sequence S) {
 	l := table.len()
 	if l == 0 {
 		return 0, 0
 	}
+	if table.ctrl != nil {
+		return i.findInGroups(table, val, hashVal)
+	}
 	cursor = int(hashVal) & (l - 1)
 	start := cursor
+	insertAt := -1
+	probes := 0
 	for table.entries[cursor].sequence != 0 {
-		if table.entries[cursor].hash == hashVal {
-			if seq := table.entries[cursor].sequence; i.sb.Get(int(i.ib.lookup(seq))) == val {
+		if seq := table.entries[cursor].sequence; seq == tombstone[S]() {
+			if insertAt == -1 {
+				insertAt = cursor
+			}
+		} else if table.entries[cursor].hash == hashVal {
+			if i.sb.Get(int(i.ib.lookup(seq))) == val {
+				i.checkProbes(probes)
 				return cursor, table.entries[cursor].sequence
 			}
 		}
+		probes++
 		cursor++
 		if cursor == l {
 			cursor = 0
 		}
 		if cursor == start {
-			panic("out of space!")
+			if insertAt != -1 {
+				break
+			}
+			i.checkProbes(probes)
+			return -1, 0
 		}
 	}
+	i.checkProbes(probes)
+	if insertAt != -1 {
+		return insertAt, 0
+	}
 	return cursor, 0
 }
 
-func (i *SymbolTab) copyEntryToTable(table table, hash uint32, seq uint32) {
+// copyEntryToTable adds an entry to table. We only copy into tables that have more
+// space than the live entries in the table we're copying from, so it can't run out
+// of space.
+func (i *Tab[S]) copyEntryToTable(table table[S], hash uint32, seq S) {
+	if table.ctrl != nil {
+		table.copyEntryToGroups(hash, seq)
+		return
+	}
 	l := table.len()
 	cursor := int(hash) & (l - 1)
 	start := cursor
 	for table.entries[cursor].sequence != 0 {
 		// the entry we're copying in is guaranteed not to be already
-		// present, so we're just looking for an empty space
+		// present, so we're just looking for an empty space. We don't reuse
+		// tombstones here so we don't need to keep track of them.
 		cursor++
 		if cursor == l {
 			cursor = 0
@@ -173,30 +382,30 @@ func (i *SymbolTab) copyEntryToTable(table table, hash uint32, seq uint32) {
 			panic("out of space (resize)!")
 		}
 	}
-	table.entries[cursor] = tableEntry{
+	table.entries[cursor] = tableEntry[S]{
 		hash:     hash,
 		sequence: seq,
 	}
 }
 
-func (i *SymbolTab) resizeWork() {
-	// We copy items between tables 16 at a time. Since we do this every time
-	// anyone writes to the table we won't run out of space in the new table
-	// before this is complete
+func (i *Tab[S]) resizeWork() {
+	// We copy items between tables a batch at a time. Since we do this every
+	// time anyone writes to the table we won't run out of space in the new
+	// table before this is complete. See tuning.validate.
 	l := i.oldTable.len()
 	if l == 0 {
 		return
 	}
-	for k := 0; k < 16; k++ {
-		offset := k + i.oldTableCursor
-		if seq := i.oldTable.entries[offset]; seq.sequence != 0 {
+	end := min(i.oldTableCursor+i.tuning.batch(), l)
+	for offset := i.oldTableCursor; offset < end; offset++ {
+		if entry := i.oldTable.entries[offset]; entry.live() {
 			i.copyEntryToTable(i.table, i.oldTable.entries[offset].hash, i.oldTable.entries[offset].sequence)
 			// The entry can exist in the old and new versions of the table without
 			// problems. If we did try to delete from the old table we'd have issues
 			// searching forward from clashing entries.
 		}
 	}
-	i.oldTableCursor += 16
+	i.oldTableCursor = end
 	if i.oldTableCursor >= l {
 		// resizing is complete - clear out the old table
 		i.oldTable.entries = nil
@@ -204,44 +413,186 @@ func (i *SymbolTab) resizeWork() {
 	}
 }
 
-func (i *SymbolTab) resize() {
+func (i *Tab[S]) resize() error {
 	if i.table.entries == nil {
 		// Makes zero value of SymbolTab useful
-		i.table.entries = make([]tableEntry, 16)
+		i.table = newTable[S](16, i.tuning.layout)
 	}
 
-	if i.count < i.table.len()/loadFactor {
-		// Not full enough to grow the table
-		return
+	used := i.count + i.tombstones
+	growAt := i.tuning.growAt(i.table.len())
+	if used < growAt {
+		// Not full enough to grow the table. If we're getting close, we start
+		// allocating the table we'll grow into.
+		if i.nextLen == 0 && i.oldTable.entries == nil && used >= growAt-growAt/prepareWindow {
+			i.prepareNext()
+		}
+		return nil
 	}
 
 	if i.oldTable.entries == nil {
-		// Not already resizing, so kick off the process. Note that despite all the work we do to try to be
-		// clever, just allocating these slices can cause a considerable amount of work, presumably because
-		// they are set to zero.
-		i.oldTable, i.table = i.table, table{
-			entries: make([]tableEntry, len(i.table.entries)*2),
+		if i.nextTableLen() == 0 {
+			// We can't grow the table any more. We can let the table get fuller
+			if used >= i.table.len()/4*3 {
+				// Things will probably go wrong if we get this full. This is
+				// the end.
+				return ErrFull
+			}
+			return nil
 		}
+		// Not already resizing, so kick off the process.
+		i.oldTable, i.table = i.table, i.takeNext()
+		i.tombstones = 0
+		i.resizes++
+	}
+	return nil
+}
+
+const (
+	// prepareWindow controls when we start allocating the table we'll grow
+	// into. We start when there's 1/prepareWindow of the space left before we
+	// need to grow.
+	prepareWindow = 4
+	// backgroundAllocLen is the smallest table we allocate in the background.
+	// Smaller tables are quick to allocate, so it's not worth it.
+	backgroundAllocLen = 1 << 16
+)
+
+// maxTableLen is the largest table we grow to. Hashes are 32 bits, so a
+// larger table would not spread the strings out any further. It's a variable
+// so tests can lower it.
+var maxTableLen = min(1<<32, math.MaxInt/2+1)
+
+// prepareNext starts allocating the table we'll grow into in the background.
+// Just allocating a very large table takes a long time, as the memory has to
+// be zeroed. Worse, while the GC is running it makes goroutines that allocate
+// help with marking, in proportion to the amount they allocate. Allocating the
+// table on another goroutine means no insert has to wait for either.
+func (i *Tab[S]) prepareNext() {
+	l := i.nextTableLen()
+	i.nextLen = l
+	if l < backgroundAllocLen {
+		// This includes l == 0, when we can't grow
+		return
+	}
+	next, layout := make(chan table[S], 1), i.tuning.layout
+	go func() {
+		next <- newTable[S](l, layout)
+	}()
+	i.next = next
+}
+
+// takeNext returns the table to grow into. This is the table allocated by
+// prepareNext if it is the right size, otherwise a new one.
+func (i *Tab[S]) takeNext() table[S] {
+	next, nextLen := i.next, i.nextLen
+	i.next, i.nextLen = nil, 0
+	l := i.nextTableLen()
+	i.reserveLen = 0
+	if next != nil && nextLen == l {
+		// prepareNext should have finished long ago, so this shouldn't block
+		return <-next
 	}
+	return newTable[S](l, i.tuning.layout)
+}
+
+// nextTableLen returns the size of table to grow into, or 0 if the table is as
+// large as it can get
+func (i *Tab[S]) nextTableLen() int {
+	l := i.table.len()
+	if i.reserveLen > l {
+		return i.reserveLen
+	}
+	if i.count < i.tuning.growAt(l)/2 {
+		// The table is mostly full of tombstones. Tombstones aren't copied, so we can
+		// clear them out by copying to a table of the same size.
+		return l
+	}
+	if l >= maxTableLen {
+		return 0
+	}
+	return min(l*i.tuning.growthFactor(), maxTableLen)
 }
 
 // table represents a hash table. We keep the strings and hashes separate in
 // case we want to use different size types in the future
-type table struct {
+type table[S Sequence] struct {
 	// We keep hashes in the table to speed up resizing, and also stepping
 	// through entries that have different hashes but hit the same bucket.
 	//
 	// Having entries with both the key and value together appears to speed up
 	// the table when it's very large. I'd guess if the "value" of the table
 	// (the sequence number) was larger this might not be the case.
-	entries []tableEntry
+	entries []tableEntry[S]
+	// ctrl holds the control bytes for the swiss layout, one uint64 for each
+	// group of entries. It is nil for the linear layout. See swiss.go.
+	ctrl []uint64
 }
 
-type tableEntry struct {
+// newTable allocates a table with l entries
+func newTable[S Sequence](l int, layout Layout) table[S] {
+	t := table[S]{entries: make([]tableEntry[S], l)}
+	if layout == LayoutSwiss {
+		t.ctrl = make([]uint64, l/groupSize)
+	}
+	return t
+}
+
+// tableEntry is 8 bytes for uint16 and uint32 sequence numbers, and 16 bytes for
+// uint64 sequence numbers.
+type tableEntry[S Sequence] struct {
 	hash     uint32
-	sequence uint32
+	sequence S
+}
+
+// live returns true if the entry is in use and is not a tombstone
+func (e tableEntry[S]) live() bool {
+	return e.sequence != 0 && e.sequence != tombstone[S]()
 }
 
-func (t table) len() int {
+func (t table[S]) len() int {
 	return len(t.entries)
 }
+
+// size returns the memory used by the table in bytes
+func (t table[S]) size() int {
+	return len(t.entries)*int(unsafe.Sizeof(tableEntry[S]{})) + len(t.ctrl)*int(unsafe.Sizeof(uint64(0)))
+}
+
+// isTombstone returns true if the entry at cursor is a tombstone. With the
+// swiss layout we can tell from the control byte, which saves reading an entry
+// that we're only going to write.
+func (t table[S]) isTombstone(cursor int) bool {
+	if t.ctrl != nil {
+		return t.ctrl[cursor/groupSize]>>(cursor%groupSize*8)&0xff == ctrlDeleted
+	}
+	return t.entries[cursor].sequence == tombstone[S]()
+}
+
+// set stores the entry for a string at cursor
+func (t table[S]) set(cursor int, hash uint32, seq S) {
+	t.entries[cursor] = tableEntry[S]{
+		hash:     hash,
+		sequence: seq,
+	}
+	if t.ctrl != nil {
+		t.setCtrl(cursor, ctrlHash(hash))
+	}
+}
+
+// remove deletes the entry at cursor. It returns true if it leaves a tombstone
+// in its place.
+func (t table[S]) remove(cursor int) bool {
+	if t.ctrl != nil && ctrlGroup(t.ctrl[cursor/groupSize]).matchEmpty() != 0 {
+		// Lookups stop at a group with an empty entry, so none continue past
+		// this group. We can make the entry empty rather than a tombstone.
+		t.entries[cursor] = tableEntry[S]{}
+		t.setCtrl(cursor, ctrlEmpty)
+		return false
+	}
+	t.entries[cursor] = tableEntry[S]{sequence: tombstone[S]()}
+	if t.ctrl != nil {
+		t.setCtrl(cursor, ctrlDeleted)
+	}
+	return true
+}
@@ -2,12 +2,14 @@ package symboltab
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBasic(t *testing.T) {
@@ -89,6 +91,96 @@ func TestAddNew(t *testing.T) {
 	assert.Equal(t, uint32(1), seq)
 }
 
+func TestBytesToSequence(t *testing.T) {
+	st := New(16)
+	val := []byte("hat")
+
+	seq, found := st.BytesToSequence(val, false)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+
+	seq, found = st.BytesToSequence(val, true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	// The table should have taken a copy
+	val[0] = 'c'
+	assert.Equal(t, "hat", st.SequenceToString(1))
+
+	seq, found = st.BytesToSequence([]byte("hat"), false)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	// Bytes and strings should find the same entries
+	seq, found = st.StringToSequence("cat", true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(2), seq)
+	seq, found = st.BytesToSequence(val, true)
+	assert.True(t, found)
+	assert.Equal(t, uint32(2), seq)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		st.BytesToSequence(val, false)
+		st.BytesToSequence(val, true)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestLookupSequence(t *testing.T) {
+	var st SymbolTab
+
+	for _, seq := range []uint32{0, 1, math.MaxUint32} {
+		val, ok := st.LookupSequence(seq)
+		assert.False(t, ok)
+		assert.Empty(t, val)
+	}
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	for _, seq := range []uint32{0, 1001, intbanksize * 4, math.MaxUint32} {
+		val, ok := st.LookupSequence(seq)
+		assert.False(t, ok)
+		assert.Empty(t, val)
+	}
+	for _, seq := range []uint32{1, 37, 1000} {
+		val, ok := st.LookupSequence(seq)
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+}
+
+func TestAll(t *testing.T) {
+	st := New(16)
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	var expSeq uint32
+	for seq, val := range st.All() {
+		expSeq++
+		assert.Equal(t, expSeq, seq)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+	assert.Equal(t, uint32(1000), expSeq)
+
+	var count int
+	for val := range st.Strings() {
+		assert.Equal(t, strconv.Itoa(count), val)
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count)
+
+	var empty SymbolTab
+	for range empty.All() {
+		t.Fatal("empty table should have no entries")
+	}
+}
+
 func TestLowGC(t *testing.T) {
 	st := New(16)
 	for i := 0; i < 1e7; i++ {
@@ -190,9 +282,85 @@ func ExampleSymbolTab() {
 	// 10293-ahdb-28383-555
 }
 
+func ExampleSymbolTab_All() {
+	st := SymbolTab{}
+	st.StringToSequence("cheese", true)
+	st.StringToSequence("hat", true)
+	for seq, val := range st.All() {
+		fmt.Println(seq, val)
+	}
+	// Output: 1 cheese
+	// 2 hat
+}
+
 func BenchmarkMakeBigSlice(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		sl := make([]int32, 1e8)
 		runtime.KeepAlive(sl)
 	}
 }
+
+func TestPrepareNext(t *testing.T) {
+	st := New(1 << 15)
+	require.Equal(t, backgroundAllocLen, st.Cap())
+
+	// Once the table is 3/4 of the way to growing we start allocating the next
+	// table in the background
+	growAt := backgroundAllocLen / 2
+	for i := range growAt - growAt/prepareWindow {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Zero(t, st.nextLen)
+	st.StringToSequence("one more", true)
+	assert.Equal(t, 2*backgroundAllocLen, st.nextLen)
+	assert.NotNil(t, st.next)
+
+	for i := range growAt {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Equal(t, 2*backgroundAllocLen, st.Cap())
+	assert.Equal(t, 1, st.resizes)
+	assert.Zero(t, st.nextLen)
+	assert.Nil(t, st.next)
+	for i := range growAt {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(seq))
+	}
+}
+
+func TestPrepareNextChangeOfPlan(t *testing.T) {
+	st := New(1 << 15)
+	growAt := backgroundAllocLen / 2
+	for i := range growAt - 100 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	require.Equal(t, 2*backgroundAllocLen, st.nextLen)
+
+	// If most strings are deleted we rebuild the table at the same size
+	// instead, so we can't use the table we prepared
+	for i := range growAt - 200 {
+		st.Delete(strconv.Itoa(i))
+	}
+	// New strings may reuse tombstones, so we don't know exactly when the
+	// table will be rebuilt
+	for i := 0; st.resizes == 0 && i < growAt; i++ {
+		st.StringToSequence("new"+strconv.Itoa(i), true)
+	}
+	assert.Equal(t, 1, st.resizes)
+	assert.Equal(t, backgroundAllocLen, st.Cap())
+}
+
+func TestPrepareNextSmall(t *testing.T) {
+	// Small tables are allocated when they're needed
+	st := New(0)
+	for i := range 7 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Equal(t, 32, st.nextLen)
+	assert.Nil(t, st.next)
+	for i := range 9 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+	assert.Equal(t, 32, st.Cap())
+}
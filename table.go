@@ -0,0 +1,30 @@
+package symboltab
+
+import "iter"
+
+// Table is the set of methods shared by the symbol table implementations SymbolTab, Naive
+// and offheap.SymbolTab, so that they can be used interchangeably. Package tabletest
+// contains tests that any implementation should pass.
+type Table interface {
+	// StringToSequence looks up the string val and returns its sequence number seq. If val
+	// is not present it is added if addNew is true. found indicates whether val was
+	// already present.
+	StringToSequence(val string, addNew bool) (seq uint32, found bool)
+	// BytesToSequence is like StringToSequence but takes a byte slice.
+	BytesToSequence(val []byte, addNew bool) (seq uint32, found bool)
+	// SequenceToString returns the string for seq. It may panic if seq is not valid.
+	SequenceToString(seq uint32) string
+	// LookupSequence returns the string for seq. ok is false if seq is not valid.
+	LookupSequence(seq uint32) (val string, ok bool)
+	// Len returns the number of strings stored.
+	Len() int
+	// All iterates over the sequence numbers and strings in sequence order.
+	All() iter.Seq2[uint32, string]
+	// Strings iterates over the strings in sequence order.
+	Strings() iter.Seq[string]
+}
+
+var (
+	_ Table = (*SymbolTab)(nil)
+	_ Table = (*Naive)(nil)
+)
@@ -0,0 +1,63 @@
+package symboltab_test
+
+import (
+	"testing"
+
+	"github.com/philpearl/symboltab"
+	"github.com/philpearl/symboltab/tabletest"
+)
+
+func TestTableSymbolTab(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		return symboltab.New(16)
+	})
+}
+
+func TestTableSymbolTabZero(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		return &symboltab.SymbolTab{}
+	})
+}
+
+func TestTableSymbolTabHash(t *testing.T) {
+	for _, hash := range []symboltab.Hash{
+		symboltab.HashMaphash,
+		symboltab.HashXXH3,
+		symboltab.HashWyhash,
+		symboltab.HashCustom("java", func(b []byte) uint64 {
+			var h uint64
+			for _, c := range b {
+				h = h*31 + uint64(c)
+			}
+			return h
+		}),
+	} {
+		t.Run(hash.String(), func(t *testing.T) {
+			tabletest.Run(t, func(t *testing.T) symboltab.Table {
+				return symboltab.NewWithHash(16, hash)
+			})
+		})
+	}
+}
+
+func TestTableSymbolTabSwiss(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		st, err := symboltab.NewWithOptions(symboltab.WithLayout(symboltab.LayoutSwiss))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	})
+}
+
+func TestTableNaive(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		return symboltab.NewNaive(16)
+	})
+}
+
+func TestTableNaiveZero(t *testing.T) {
+	tabletest.Run(t, func(t *testing.T) symboltab.Table {
+		return &symboltab.Naive{}
+	})
+}
@@ -0,0 +1,157 @@
+// Package tabletest contains tests that any implementation of symboltab.Table should
+// pass.
+package tabletest
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/philpearl/symboltab"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run runs the conformance tests against the implementation returned by newTable.
+// newTable is called for each sub-test and should return a new empty table. Use
+// t.Cleanup to release any resources the table holds.
+func Run(t *testing.T, newTable func(t *testing.T) symboltab.Table) {
+	t.Run("basic", func(t *testing.T) { testBasic(t, newTable(t)) })
+	t.Run("addNew", func(t *testing.T) { testAddNew(t, newTable(t)) })
+	t.Run("growth", func(t *testing.T) { testGrowth(t, newTable(t)) })
+	t.Run("bytes", func(t *testing.T) { testBytes(t, newTable(t)) })
+	t.Run("lookupSequence", func(t *testing.T) { testLookupSequence(t, newTable(t)) })
+	t.Run("iterators", func(t *testing.T) { testIterators(t, newTable(t)) })
+}
+
+func testBasic(t *testing.T, st symboltab.Table) {
+	assertStringToSequence := func(seq uint32, existing bool, val string) {
+		t.Helper()
+		seqa, existinga := st.StringToSequence(val, true)
+		assert.Equal(t, existing, existinga)
+		assert.Equal(t, seq, seqa)
+	}
+
+	assert.Zero(t, st.Len())
+	assertStringToSequence(1, false, "a1")
+	assertStringToSequence(2, false, "a2")
+	assertStringToSequence(3, false, "a3")
+	assertStringToSequence(2, true, "a2")
+	assertStringToSequence(3, true, "a3")
+	assertStringToSequence(4, false, "")
+	assertStringToSequence(4, true, "")
+	assert.Equal(t, 4, st.Len())
+
+	assert.Equal(t, "a1", st.SequenceToString(1))
+	assert.Equal(t, "a2", st.SequenceToString(2))
+	assert.Equal(t, "a3", st.SequenceToString(3))
+	assert.Equal(t, "", st.SequenceToString(4))
+}
+
+func testAddNew(t *testing.T, st symboltab.Table) {
+	// Won't add entry if asked not to
+	seq, existing := st.StringToSequence("hat", false)
+	assert.False(t, existing)
+	assert.Zero(t, seq)
+	assert.Zero(t, st.Len())
+
+	seq, existing = st.StringToSequence("hat", true)
+	assert.False(t, existing)
+	assert.Equal(t, uint32(1), seq)
+
+	// Can find existing entry if not asked to add new
+	seq, existing = st.StringToSequence("hat", false)
+	assert.True(t, existing)
+	assert.Equal(t, uint32(1), seq)
+}
+
+func testGrowth(t *testing.T, st symboltab.Table) {
+	const n = 50_000
+	for i := range n {
+		seq, found := st.StringToSequence(strconv.Itoa(i), true)
+		assert.False(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+	}
+	assert.Equal(t, n, st.Len())
+
+	for i := range n {
+		seq, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.True(t, found)
+		assert.Equal(t, uint32(i+1), seq)
+		assert.Equal(t, strconv.Itoa(i), st.SequenceToString(uint32(i+1)))
+	}
+
+	for i := n; i < n+1000; i++ {
+		_, found := st.StringToSequence(strconv.Itoa(i), false)
+		assert.False(t, found)
+	}
+}
+
+func testBytes(t *testing.T, st symboltab.Table) {
+	val := []byte("hat")
+	seq, found := st.BytesToSequence(val, true)
+	assert.False(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	// The table must keep its own copy
+	val[0] = 'c'
+	assert.Equal(t, "hat", st.SequenceToString(1))
+
+	seq, found = st.StringToSequence("hat", false)
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), seq)
+
+	seq, found = st.BytesToSequence(val, false)
+	assert.False(t, found)
+	assert.Zero(t, seq)
+}
+
+func testLookupSequence(t *testing.T, st symboltab.Table) {
+	for _, seq := range []uint32{0, 1, math.MaxUint32} {
+		val, ok := st.LookupSequence(seq)
+		assert.False(t, ok)
+		assert.Empty(t, val)
+	}
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	for _, seq := range []uint32{0, 1001, 1 << 20, math.MaxUint32} {
+		val, ok := st.LookupSequence(seq)
+		assert.False(t, ok, seq)
+		assert.Empty(t, val)
+	}
+	for _, seq := range []uint32{1, 37, 1000} {
+		val, ok := st.LookupSequence(seq)
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+}
+
+func testIterators(t *testing.T, st symboltab.Table) {
+	for range st.All() {
+		t.Fatal("empty table should have no entries")
+	}
+
+	for i := range 1000 {
+		st.StringToSequence(strconv.Itoa(i), true)
+	}
+
+	var expSeq uint32
+	for seq, val := range st.All() {
+		expSeq++
+		assert.Equal(t, expSeq, seq)
+		assert.Equal(t, strconv.Itoa(int(seq-1)), val)
+	}
+	assert.Equal(t, uint32(1000), expSeq)
+
+	var count int
+	for val := range st.Strings() {
+		assert.Equal(t, strconv.Itoa(count), val)
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count)
+}